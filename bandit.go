@@ -0,0 +1,99 @@
+package illygen
+
+import "math"
+
+// UCB1 returns a bandit Strategy that treats a node's outgoing Links as arms
+// and balances exploiting the best mean reward against exploring Links with
+// few pulls, using the UCB1 upper confidence bound:
+//
+//	score = MeanReward + sqrt(2 · ln(total pulls) / Pulls)
+//
+// Links that have never been rewarded are tried first, highest weight first.
+// Rewards come from Flow.Feedback and are assumed to be in the range 0.0 to 1.0.
+// UCB1 is deterministic — it never consumes randomness.
+func UCB1() Strategy {
+	return ucb1{}
+}
+
+// ThompsonSampling returns a bandit Strategy that models each outgoing Link's
+// reward as a Beta distribution, draws one sample per Link and follows the
+// highest draw. Links with little feedback have wide distributions and so
+// still get explored.
+//
+// Rewards come from Flow.Feedback and are clamped to the range 0.0 to 1.0:
+// a reward r counts as r successes and 1 - r failures.
+func ThompsonSampling() Strategy {
+	return thompson{}
+}
+
+type ucb1 struct{}
+
+func (ucb1) Choose(_ string, edges []Edge, _ Rand) Edge {
+	total := 0
+	for _, e := range edges {
+		if e.Pulls == 0 {
+			return e // edges are sorted by weight, so this is the strongest untried link
+		}
+		total += e.Pulls
+	}
+
+	best, bestScore := edges[0], math.Inf(-1)
+	for _, e := range edges {
+		score := e.MeanReward + math.Sqrt(2*math.Log(float64(total))/float64(e.Pulls))
+		if score > bestScore {
+			best, bestScore = e, score
+		}
+	}
+	return best
+}
+
+type thompson struct{}
+
+func (thompson) Choose(_ string, edges []Edge, rnd Rand) Edge {
+	best, bestDraw := edges[0], math.Inf(-1)
+	for _, e := range edges {
+		successes := clamp01(e.MeanReward) * float64(e.Pulls)
+		failures := float64(e.Pulls) - successes
+		draw := sampleBeta(1+successes, 1+failures, rnd)
+		if draw > bestDraw {
+			best, bestDraw = e, draw
+		}
+	}
+	return best
+}
+
+// sampleBeta draws from Beta(a, b) via two Gamma draws. a and b must be >= 1.
+func sampleBeta(a, b float64, rnd Rand) float64 {
+	x := sampleGamma(a, rnd)
+	y := sampleGamma(b, rnd)
+	return x / (x + y)
+}
+
+// sampleGamma draws from Gamma(shape, 1) using Marsaglia and Tsang's method.
+// shape must be >= 1.
+func sampleGamma(shape float64, rnd Rand) float64 {
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := sampleNormal(rnd)
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rnd.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+// sampleNormal draws from the standard normal distribution (Box-Muller).
+func sampleNormal(rnd Rand) float64 {
+	u1 := rnd.Float64()
+	for u1 == 0 {
+		u1 = rnd.Float64()
+	}
+	u2 := rnd.Float64()
+	return math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2)
+}
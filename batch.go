@@ -0,0 +1,154 @@
+package illygen
+
+import (
+	"errors"
+	"fmt"
+)
+
+// KnowledgeBatch stages changes to a KnowledgeStore and applies them all at
+// once with Commit. Get one from KnowledgeStore.Batch.
+//
+// A KnowledgeBatch is not safe for concurrent use.
+type KnowledgeBatch struct {
+	store *KnowledgeStore
+	ops   []batchOp
+}
+
+// batchOp is one staged change. unit is set for adds, facts for updates.
+type batchOp struct {
+	kind  VersionKind
+	id    string
+	unit  *KnowledgeUnit
+	facts map[string]any
+}
+
+// Batch starts a batch of changes to the store. Nothing is written until
+// Commit, and then either every change is applied or none is: readers
+// never see the store half-updated. Changes are recorded with the author
+// of the handle Batch was called on.
+//
+//	err := store.Batch().
+//	    Add("g1", "greetings", map[string]any{"response": "Hi!"}).
+//	    Update("g0", map[string]any{"response": "Hello!"}).
+//	    Delete("old").
+//	    Commit()
+func (s *KnowledgeStore) Batch() *KnowledgeBatch {
+	return &KnowledgeBatch{store: s}
+}
+
+// Add stages KnowledgeStore.Add. Returns the KnowledgeBatch for chaining.
+func (b *KnowledgeBatch) Add(id, domain string, facts map[string]any) *KnowledgeBatch {
+	return b.add(&KnowledgeUnit{ID: id, Domain: domain, Facts: facts, Weight: 1.0})
+}
+
+// Train stages KnowledgeStore.Train. Returns the KnowledgeBatch for chaining.
+func (b *KnowledgeBatch) Train(id, domain string, facts map[string]any, weight float64) *KnowledgeBatch {
+	return b.add(trainedUnit(id, domain, facts, weight))
+}
+
+func (b *KnowledgeBatch) add(u *KnowledgeUnit) *KnowledgeBatch {
+	b.ops = append(b.ops, batchOp{kind: VersionAdded, id: u.ID, unit: u})
+	return b
+}
+
+// Update stages KnowledgeStore.Update. Returns the KnowledgeBatch for chaining.
+func (b *KnowledgeBatch) Update(id string, facts map[string]any) *KnowledgeBatch {
+	b.ops = append(b.ops, batchOp{kind: VersionUpdated, id: id, facts: facts})
+	return b
+}
+
+// Delete stages KnowledgeStore.Delete. Returns the KnowledgeBatch for chaining.
+func (b *KnowledgeBatch) Delete(id string) *KnowledgeBatch {
+	b.ops = append(b.ops, batchOp{kind: VersionDeleted, id: id})
+	return b
+}
+
+// Len returns the number of changes staged.
+func (b *KnowledgeBatch) Len() int { return len(b.ops) }
+
+// Commit applies the staged changes in order, as if each were made by the
+// KnowledgeStore method of the same name, and atomically: if any of them
+// fails, none is applied and Commit returns every failure, joined with
+// errors.Join. Later changes see earlier ones, so a batch may add a unit
+// and then update it. Every change is stamped with the same time.
+// Commit leaves the batch empty, whether it succeeds or not.
+func (b *KnowledgeBatch) Commit() error {
+	ops := b.ops
+	b.ops = nil
+	s := b.store
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+	now := s.base.clock.Now()
+
+	// staged holds the units the batch has changed so far, nil if deleted.
+	staged := make(map[string]*KnowledgeUnit)
+	current := func(id string) (*KnowledgeUnit, bool) {
+		if u, ok := staged[id]; ok {
+			return u, u != nil
+		}
+		u, ok := s.base.units[id]
+		return u, ok
+	}
+
+	type change struct {
+		id   string
+		unit *KnowledgeUnit
+		kind VersionKind
+	}
+	var changes []change
+	var errs []error
+	for _, op := range ops {
+		var u *KnowledgeUnit
+		switch op.kind {
+		case VersionAdded:
+			if err := checkNewUnit(op.unit); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if _, exists := current(op.id); exists {
+				errs = append(errs, fmt.Errorf("illygen: knowledge unit %q already exists", op.id))
+				continue
+			}
+			if err := s.base.checkFacts(op.unit); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			c := *op.unit
+			c.Updated = now
+			u = &c
+		case VersionUpdated:
+			old, ok := current(op.id)
+			if !ok {
+				errs = append(errs, fmt.Errorf("illygen: knowledge unit %q not found", op.id))
+				continue
+			}
+			c := *old
+			c.Facts = op.facts
+			if err := s.base.checkFacts(&c); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			c.Updated = now
+			u = &c
+		case VersionDeleted:
+			if _, ok := current(op.id); !ok {
+				errs = append(errs, fmt.Errorf("illygen: knowledge unit %q not found", op.id))
+				continue
+			}
+		}
+		staged[op.id] = u
+		changes = append(changes, change{id: op.id, unit: u, kind: op.kind})
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for _, c := range changes {
+		s.commit(c.id, c.unit, c.kind, now)
+	}
+	return nil
+}
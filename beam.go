@@ -0,0 +1,309 @@
+package illygen
+
+import (
+	"sort"
+	"time"
+
+	"github.com/leraniode/illygen/internal/runtime"
+)
+
+// BeamOptions bounds a beam search run. Zero values pick the defaults.
+type BeamOptions struct {
+	// Width is how many partial paths are kept alive after each round (default 3).
+	Width int
+
+	// MaxSteps is the total number of node executions allowed across
+	// all paths (default 100). It keeps the search bounded on cyclic flows.
+	MaxSteps int
+}
+
+// Candidate is one complete path found by a beam search.
+type Candidate struct {
+	// Trace is the path taken, ending at a node with no next node.
+	Trace *Trace
+
+	// Score is the product of every followed Link weight, multiplied by
+	// the mean Confidence of the nodes on the path.
+	Score float64
+}
+
+// BeamResult is what Engine.Beam returns.
+type BeamResult struct {
+	// Best is the highest-scoring complete path.
+	Best Candidate
+
+	// Alternatives holds the runner-up complete paths, best first.
+	Alternatives []Candidate
+}
+
+// Beam explores the top-K paths through a flow instead of committing to a
+// single route, and returns the best-scoring complete path plus runner-ups.
+//
+// Whenever a node leaves Result.Next empty, every outgoing Link is expanded,
+// each on its own deep copy of the Context, as made by Engine.Isolate: nodes
+// may mutate nested maps and slices without the change reaching the caller
+// or another path. The caller's Context is never written; each Candidate's
+// final Context is in its Trace. After each round only the Width
+// highest-scoring partial paths survive. A node that sets Result.Next has
+// made its own choice and is not branched.
+//
+// Because nodes are consulted once per path, they may run several times
+// in one search — nodes with side effects beyond the Context should not be
+// beam searched. The routing Strategy is not used and Hooks are not called,
+// but Middleware is applied and so are the Engine's Limits: Timeout and
+// NodeTimeout bound the whole search and each node, and a path that exceeds
+// MaxVisits or MaxSteps is dropped. If no path completes, Beam returns the
+// *CycleError or *StepLimitError that dropped the last one, or a
+// *StepLimitError once the search exhausts BeamOptions.MaxSteps.
+//
+// Links are scored by their weight. A node that sets Result.Next to a node
+// it has no Link to is scored by its own Confidence instead, so explicit
+// routing neither outranks nor is outranked by Links as such.
+//
+//	res, err := engine.Beam(flow, ctx, illygen.BeamOptions{Width: 3})
+//	fmt.Println(res.Best.Trace.Result.Value)
+func (e *Engine) Beam(flow *Flow, ctx Context, opts BeamOptions) (*BeamResult, error) {
+	if opts.Width <= 0 {
+		opts.Width = 3
+	}
+	if opts.MaxSteps <= 0 {
+		opts.MaxSteps = 100
+	}
+	// Every path works on its own deep copy, so the caller's Context is never
+	// written. runContext already makes one for an isolated engine.
+	if !e.isolate {
+		ctx = ctx.deepClone()
+	}
+	ctx = e.runContext(ctx, nil)
+	state := ctx.run()
+	defer state.end()
+
+	entry, err := flow.entryNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := flow.validateInputs(ctx); err != nil {
+		return nil, err
+	}
+
+	active := []*beamPath{{ctx: ctx, node: entry.ID(), weight: 1}}
+	if e.recordChanges {
+		active[0].initial = ctx.snapshot()
+	}
+	var done []*beamPath
+	budget := opts.MaxSteps
+
+	var deadline time.Time
+	if e.limits.Timeout > 0 {
+		deadline = time.Now().Add(e.limits.Timeout)
+	}
+	var dropped error // the limit that dropped the last path, if any
+
+	for len(active) > 0 && budget > 0 {
+		var expanded []*beamPath
+		for _, p := range active {
+			if budget == 0 {
+				break
+			}
+			if err := p.exceeds(e.limits); err != nil {
+				dropped = err
+				continue
+			}
+			if !deadline.IsZero() && !time.Now().Before(deadline) {
+				return nil, &TimeoutError{NodeID: p.node, Timeout: e.limits.Timeout}
+			}
+			budget--
+
+			next, err := p.expand(e, flow, deadline)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range next {
+				if c.node == "" {
+					done = append(done, c)
+				} else {
+					expanded = append(expanded, c)
+				}
+			}
+		}
+
+		sort.SliceStable(expanded, func(i, j int) bool {
+			return expanded[i].score() > expanded[j].score()
+		})
+		if len(expanded) > opts.Width {
+			expanded = expanded[:opts.Width]
+		}
+		active = expanded
+	}
+
+	if len(done) == 0 {
+		if len(active) > 0 {
+			return nil, &StepLimitError{NodeID: active[0].node, Steps: opts.MaxSteps}
+		}
+		return nil, dropped
+	}
+
+	sort.SliceStable(done, func(i, j int) bool {
+		return done[i].score() > done[j].score()
+	})
+	if len(done) > opts.Width {
+		done = done[:opts.Width]
+	}
+
+	res := &BeamResult{Best: done[0].candidate()}
+	for _, p := range done[1:] {
+		res.Alternatives = append(res.Alternatives, p.candidate())
+	}
+	return res, nil
+}
+
+// beamPath is a partial path kept alive by a beam search.
+type beamPath struct {
+	ctx     Context
+	initial Context // input Context, kept with Engine.RecordChanges
+	node    string  // node to consult next; empty once the path is complete
+	steps   []Step
+	weight  float64 // product of followed link weights
+	conf    float64 // sum of node confidences
+}
+
+func (p *beamPath) score() float64 {
+	if len(p.steps) == 0 {
+		return p.weight
+	}
+	return p.weight * p.conf / float64(len(p.steps))
+}
+
+func (p *beamPath) candidate() Candidate {
+	last := p.steps[len(p.steps)-1]
+	p.ctx.stripInternal()
+	return Candidate{
+		Trace: &Trace{
+			Steps:   p.steps,
+			Result:  Result{Value: last.Value, Confidence: last.Confidence},
+			Context: p.ctx,
+			Initial: p.initial,
+		},
+		Score: p.score(),
+	}
+}
+
+// exceeds returns the error for the visit or step limit the path would
+// exceed by consulting its next node, if any.
+func (p *beamPath) exceeds(limits Limits) error {
+	if limits.MaxSteps > 0 && len(p.steps) >= limits.MaxSteps {
+		return &StepLimitError{NodeID: p.node, Steps: limits.MaxSteps}
+	}
+	if limits.AllowCycles {
+		return nil
+	}
+	max := limits.MaxVisits
+	if max <= 0 {
+		max = runtime.DefaultMaxVisits
+	}
+	visits := 1
+	for _, s := range p.steps {
+		if s.NodeID == p.node {
+			visits++
+		}
+	}
+	if visits > max {
+		return &CycleError{NodeID: p.node, Visits: visits}
+	}
+	return nil
+}
+
+// expand consults the path's current node and returns one successor path
+// per route it can take. A successor with an empty node is complete.
+func (p *beamPath) expand(e *Engine, flow *Flow, deadline time.Time) ([]*beamPath, error) {
+	node, err := flow.node(p.node)
+	if err != nil {
+		return nil, err
+	}
+	state := p.ctx.run()
+	var before Context
+	if e.recordChanges {
+		before = p.ctx.snapshot()
+	}
+
+	// A node that may time out runs on a private copy of the path's Context,
+	// as in a run, so once abandoned it cannot write to a Context in use.
+	nodeCtx := p.ctx
+	if e.limits.timed() {
+		nodeCtx = p.ctx.clone()
+	}
+	state.enter(p.node)
+	rs, err := runtime.Call(p.node, func(string) (runtime.Step, error) {
+		return runtime.Step{Data: e.wrap(node)(nodeCtx)}, nil
+	}, e.limits.runtimeLimits(), deadline)
+	if err != nil {
+		return nil, limitError(err)
+	}
+	if e.limits.timed() {
+		p.ctx.replace(nodeCtx)
+	}
+
+	result := rs.Data.(Result)
+	step := Step{NodeID: p.node, Value: result.Value, Confidence: result.Confidence}
+	step.Knowledge, step.Accesses = state.takeAudit()
+	if e.recordChanges {
+		step.Changes = diffContext(before, p.ctx)
+	}
+
+	links := flow.Edges(p.node)
+	if len(links) > 0 {
+		step.Links = links
+	}
+	var edges []Edge
+	switch {
+	case result.Next != "":
+		step.Route = RouteNext
+		// Without a Link to weigh the explicit choice, the node's own
+		// confidence in it stands in.
+		weight := result.Confidence
+		for _, edge := range links {
+			if edge.To == result.Next {
+				weight = edge.Weight
+			}
+		}
+		edges = []Edge{{From: p.node, To: result.Next, Weight: weight}}
+	default:
+		step.Route = RouteLink
+		edges = links
+	}
+
+	if len(edges) == 0 {
+		step.Route = RouteEnd
+		return []*beamPath{p.follow(step, Edge{Weight: 1}, p.ctx)}, nil
+	}
+
+	out := make([]*beamPath, 0, len(edges))
+	for i, edge := range edges {
+		if _, err := flow.node(edge.To); err != nil {
+			return nil, &RouteError{NodeID: p.node, Next: edge.To}
+		}
+		// The first successor may keep the path's Context; the others need their own.
+		ctx := p.ctx
+		if i > 0 {
+			ctx = p.ctx.fork()
+		}
+		s := step
+		s.Next = edge.To
+		out = append(out, p.follow(s, edge, ctx))
+	}
+	return out, nil
+}
+
+// follow returns a new path extending p with step, along edge e.
+func (p *beamPath) follow(step Step, e Edge, ctx Context) *beamPath {
+	steps := make([]Step, len(p.steps), len(p.steps)+1)
+	copy(steps, p.steps)
+	return &beamPath{
+		ctx:     ctx,
+		initial: p.initial,
+		node:    step.Next,
+		steps:   append(steps, step),
+		weight:  p.weight * e.Weight,
+		conf:    p.conf + step.Confidence,
+	}
+}
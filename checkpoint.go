@@ -0,0 +1,172 @@
+package illygen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// checkpointFormat is bumped whenever the checkpoint encoding changes
+// incompatibly. Checkpoints written with another format are rejected.
+const checkpointFormat = 1
+
+// checkpoint is the state of a suspended run, as encoded by Trace.Checkpoint.
+type checkpoint struct {
+	Format int
+	Flow   string // Flow.fingerprint of the flow that was suspended
+	Next   string // node to resume at
+
+	Visits     map[string]int
+	Steps      []Step
+	Context    Context
+	Initial    Context
+	FlowMemory map[string]any
+	NodeMemory map[string]map[string]any
+}
+
+// CheckpointError is returned by Engine.Resume when a checkpoint cannot be
+// decoded or was written for a different flow.
+type CheckpointError struct {
+	Problem string
+}
+
+func (e *CheckpointError) Error() string {
+	return "illygen: cannot resume: " + e.Problem
+}
+
+// Version declares the version of the flow's logic. Checkpoints record it,
+// and Engine.Resume rejects a checkpoint whose version differs. Bump it when
+// node behaviour changes in a way suspended runs must not resume into;
+// changes to nodes or Links are detected without it.
+// Returns the Flow for chaining.
+func (f *Flow) Version(v string) *Flow {
+	f.version = v
+	return f
+}
+
+// fingerprint identifies the flow's structure: its name, version, entry,
+// nodes and Links. Link weights and bandit statistics are left out, as they
+// change as the flow learns.
+func (f *Flow) fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "name=%q version=%q entry=%q\n", f.name, f.version, f.entry)
+	for _, id := range sortedKeys(f.nodes) {
+		fmt.Fprintf(h, "node %q\n", id)
+	}
+	links := make([]string, 0)
+	for _, e := range f.graph.All() {
+		links = append(links, fmt.Sprintf("link %q %q\n", e.From, e.To))
+	}
+	sort.Strings(links)
+	for _, l := range links {
+		fmt.Fprint(h, l)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Checkpoint encodes a suspended run — the node to resume at, visit counts,
+// Context, memory and the steps so far — so it can be stored and later
+// passed to Engine.Resume, on this or any other Engine.
+//
+// The encoding is encoding/gob. Go's basic types, []any, map[string]any
+// (as decoded from JSON), Context and Result are registered already; values
+// of other types in the Context, memory or Steps must be registered with
+// gob.Register.
+// Returns an error if the run was not suspended.
+func (t *Trace) Checkpoint() ([]byte, error) {
+	if t.checkpoint == nil {
+		return nil, fmt.Errorf("illygen: run was not suspended — nothing to checkpoint")
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(t.checkpoint); err != nil {
+		return nil, fmt.Errorf("illygen: encoding checkpoint: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Resume continues a suspended run from its checkpoint (see Result.Suspend
+// and Trace.Checkpoint). input is merged into the restored Context first —
+// typically the human input the run was waiting for — and is never written.
+// The flow must be the one the run was suspended in: a checkpoint written
+// for a flow with other nodes, Links, name or Version returns a
+// *CheckpointError.
+//
+// The returned Trace continues the suspended one: its Steps start with the
+// steps taken before suspension. Limits count visits and steps across both,
+// except Timeout, which starts afresh. A resumed run may suspend again.
+//
+//	trace, err := engine.Resume(flow, saved, illygen.Context{"approved": true})
+func (e *Engine) Resume(flow *Flow, data []byte, input Context) (*Trace, error) {
+	return e.resume(flow, data, input, nil)
+}
+
+// Resume continues a suspended run within the session. See Engine.Resume.
+func (s *Session) Resume(flow *Flow, data []byte, input Context) (*Trace, error) {
+	return s.engine.resume(flow, data, input, s)
+}
+
+func (e *Engine) resume(flow *Flow, data []byte, input Context, session *Session) (*Trace, error) {
+	var cp checkpoint
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&cp); err != nil {
+		return nil, &CheckpointError{Problem: fmt.Sprintf("decoding checkpoint: %v", err)}
+	}
+	if cp.Format != checkpointFormat {
+		return nil, &CheckpointError{Problem: fmt.Sprintf(
+			"checkpoint format %d is not supported (want %d)", cp.Format, checkpointFormat,
+		)}
+	}
+	if cp.Flow != flow.fingerprint() {
+		return nil, &CheckpointError{Problem: "checkpoint was written for a different flow or flow version"}
+	}
+
+	ctx := cp.Context
+	if ctx == nil {
+		ctx = Context{}
+	}
+	for k, v := range input {
+		if !internalKey(k) {
+			ctx[k] = v
+		}
+	}
+	return e.runTrace(flow, ctx, runOptions{session: session, resume: &cp})
+}
+
+// suspend captures the state of a run suspended before node next.
+func (s *runState) suspend(flow *Flow, next string, visits map[string]int, steps []Step, ctx, initial Context) *checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := &checkpoint{
+		Format:     checkpointFormat,
+		Flow:       flow.fingerprint(),
+		Next:       next,
+		Visits:     visits,
+		Steps:      steps,
+		Context:    ctx.snapshot(),
+		Initial:    initial,
+		FlowMemory: s.flow.clone().data,
+		NodeMemory: make(map[string]map[string]any, len(s.nodes)),
+	}
+	for id, m := range s.nodes {
+		cp.NodeMemory[id] = m.clone().data
+	}
+	return cp
+}
+
+// restore reloads the run-scoped memory saved in a checkpoint.
+func (s *runState) restore(cp *checkpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range cp.FlowMemory {
+		s.flow.data[k] = v
+	}
+	for id, data := range cp.NodeMemory {
+		m := newMemory()
+		for k, v := range data {
+			m.data[k] = v
+		}
+		s.nodes[id] = m
+	}
+}
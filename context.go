@@ -1,5 +1,7 @@
 package illygen
 
+import "reflect"
+
 // Context is a simple map that carries data through a flow execution.
 // It is the single source of truth passed to every node during a run.
 //
@@ -11,6 +13,11 @@ package illygen
 //	}
 type Context map[string]any
 
+// internalKey reports whether key is reserved for the engine.
+func internalKey(key string) bool {
+	return key == runKey
+}
+
 // Get retrieves a value by key. Returns nil if the key doesn't exist.
 func (c Context) Get(key string) any {
 	return c[key]
@@ -42,15 +49,125 @@ func (c Context) Bool(key string) bool {
 }
 
 // Int returns a context value as an int.
-// Returns 0 if the key doesn't exist or is not an int.
+// Any integer type, and any float without a fractional part, is converted.
+// Returns 0 if the key doesn't exist or the value cannot be converted
+// (see ToInt). Use a Key[int] to tell a missing value from a zero one.
 func (c Context) Int(key string) int {
-	v, _ := c[key].(int)
+	v, _ := ToInt(c[key])
 	return v
 }
 
 // Float returns a context value as a float64.
-// Returns 0 if the key doesn't exist or is not a float64.
+// Any integer or float type is converted.
+// Returns 0 if the key doesn't exist or is not a number (see ToFloat).
 func (c Context) Float(key string) float64 {
-	v, _ := c[key].(float64)
+	v, _ := ToFloat(c[key])
+	return v
+}
+
+// clone returns a shallow copy of the context.
+func (c Context) clone() Context {
+	out := make(Context, len(c))
+	for k, v := range c {
+		out[k] = v
+	}
+	return out
+}
+
+// deepClone returns a copy of the context for an isolated run. Maps, slices
+// and arrays are copied all the way down, so nodes cannot write through to
+// the caller's data; pointers, structs, channels and functions are shared.
+// It never looks inside structs, so their unexported fields are left alone.
+// Its cost grows with the size of every map and slice in the Context.
+func (c Context) deepClone() Context {
+	var seen map[copied]reflect.Value
+	out := make(Context, len(c))
+	for k, v := range c {
+		switch v.(type) {
+		case nil, string, bool, int, int64, float64:
+			out[k] = v // immutable: no need for reflection
+			continue
+		}
+		if seen == nil {
+			seen = make(map[copied]reflect.Value)
+		}
+		out[k] = deepCopy(reflect.ValueOf(v), seen).Interface()
+	}
+	return out
+}
+
+// copied identifies a map or slice already copied by deepCopy, so values
+// shared or nested within themselves are copied once.
+type copied struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+func deepCopy(v reflect.Value, seen map[copied]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(deepCopy(v.Elem(), seen))
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		key := copied{v.Pointer(), v.Type(), 0}
+		if out, ok := seen[key]; ok {
+			return out
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		seen[key] = out
+		for it := v.MapRange(); it.Next(); {
+			out.SetMapIndex(it.Key(), deepCopy(it.Value(), seen))
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		key := copied{v.Pointer(), v.Type(), v.Len()}
+		if out, ok := seen[key]; ok {
+			return out
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		seen[key] = out
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+		return out
+	case reflect.Array:
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+		return out
+	}
 	return v
 }
+
+// replace makes c hold exactly the entries of from.
+func (c Context) replace(from Context) {
+	for k := range c {
+		if _, ok := from[k]; !ok {
+			delete(c, k)
+		}
+	}
+	for k, v := range from {
+		c[k] = v
+	}
+}
+
+// stripInternal removes every key reserved for the engine.
+func (c Context) stripInternal() {
+	for k := range c {
+		if internalKey(k) {
+			delete(c, k)
+		}
+	}
+}
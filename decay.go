@@ -0,0 +1,196 @@
+package illygen
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Clock tells a KnowledgeStore the time, for TTLs, decay and Updated
+// stamps. The default is the system clock; tests can use a ManualClock.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// ManualClock is a Clock that only moves when told to — for tests.
+// It is safe for concurrent use.
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualClock creates a ManualClock set to now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now implements Clock.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Clock sets the clock the store reads the time from.
+// Returns the KnowledgeStore for chaining.
+//
+//	clock := illygen.NewManualClock(time.Now())
+//	store := illygen.NewKnowledgeStore().Clock(clock)
+func (s *KnowledgeStore) Clock(c Clock) *KnowledgeStore {
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+	s.base.clock = c
+	return s
+}
+
+// DomainTTL makes every unit in domain expire ttl after it was last
+// Updated, unless the unit has a TTL of its own. Expired units are left out
+// of every query and removed by Sweep. A ttl of 0 removes the domain's TTL.
+// Returns the KnowledgeStore for chaining.
+//
+//	store.DomainTTL("promotions", 24*time.Hour)
+func (s *KnowledgeStore) DomainTTL(domain string, ttl time.Duration) *KnowledgeStore {
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+	setOrDelete(s.base.ttls, domain, ttl)
+	return s
+}
+
+// SetTTL makes a unit expire ttl after it was last Updated, overriding its
+// domain's TTL. A ttl of 0 falls back to the domain's TTL.
+// Returns an error if the unit does not exist.
+func (s *KnowledgeStore) SetTTL(id string, ttl time.Duration) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+	old, ok := s.base.units[id]
+	if !ok {
+		return fmt.Errorf("illygen: knowledge unit %q not found", id)
+	}
+	u := *old
+	u.TTL = ttl
+	s.commit(id, &u, VersionUpdated, s.base.clock.Now())
+	return nil
+}
+
+// Decay makes the weight of every unit in domain decay exponentially with
+// age, halving every halfLife since the unit was last Updated — or, once
+// Reinforce has set its weight, since it was Reweighted. Queries see
+// the decayed weight and order units by it; Sweep writes it back. Trained
+// units never decay below their trained weight. A halfLife of 0 stops decay.
+// Returns the KnowledgeStore for chaining.
+//
+//	store.Decay("outages", time.Hour)
+func (s *KnowledgeStore) Decay(domain string, halfLife time.Duration) *KnowledgeStore {
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+	setOrDelete(s.base.halfLives, domain, halfLife)
+	return s
+}
+
+// Sweep removes expired units, recording a VersionExpired version for each
+// so retention can later drop their history, writes decayed weights back
+// to the store without a version, then trims histories like Compact.
+// Returns the number of units removed. Call it periodically, or let
+// StartSweeper do it.
+func (s *KnowledgeStore) Sweep() int {
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+
+	now := s.base.clock.Now()
+	removed := 0
+	for id, u := range s.base.units {
+		live, ok := s.base.live(u, now)
+		switch {
+		case !ok:
+			s.commit(id, nil, VersionExpired, now)
+			removed++
+		case live != u:
+			live.decayed = now
+			s.base.units[id] = live
+		}
+	}
+	s.base.compact(now)
+	return removed
+}
+
+// StartSweeper calls Sweep every interval in a background goroutine until
+// the returned stop function is called.
+//
+//	stop := store.StartSweeper(time.Minute)
+//	defer stop()
+func (s *KnowledgeStore) StartSweeper(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.Sweep()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// live returns the unit as queries should see it at now — with its weight
+// decayed, as a copy, if its domain decays — and false if it has expired.
+// The caller must hold b.mu.
+func (b *knowledgeBase) live(u *KnowledgeUnit, now time.Time) (*KnowledgeUnit, bool) {
+	ttl := u.TTL
+	if ttl == 0 {
+		ttl = b.ttls[u.Domain]
+	}
+	if ttl > 0 && !now.Before(u.Updated.Add(ttl)) {
+		return nil, false
+	}
+
+	halfLife, ok := b.halfLives[u.Domain]
+	if !ok {
+		return u, true
+	}
+	since := u.Updated
+	if u.decayed.After(since) {
+		since = u.decayed
+	}
+	age := now.Sub(since)
+	if age <= 0 {
+		return u, true
+	}
+	w := u.Weight * math.Exp2(-float64(age)/float64(halfLife))
+	if u.Trained {
+		w = math.Max(w, u.TrainedWeight)
+	}
+	if w == u.Weight {
+		return u, true
+	}
+	c := *u
+	c.Weight = w
+	return &c, true
+}
+
+func setOrDelete(m map[string]time.Duration, key string, d time.Duration) {
+	if d > 0 {
+		m[key] = d
+	} else {
+		delete(m, key)
+	}
+}
@@ -0,0 +1,108 @@
+package illygen
+
+import (
+	"reflect"
+	"sort"
+)
+
+// ChangeKind says what a node did to a Context key.
+type ChangeKind string
+
+const (
+	// ChangeAdded means the key did not exist before the node ran.
+	ChangeAdded ChangeKind = "added"
+
+	// ChangeChanged means the node replaced the key's value.
+	ChangeChanged ChangeKind = "changed"
+
+	// ChangeRemoved means the node deleted the key.
+	ChangeRemoved ChangeKind = "removed"
+)
+
+// Change records one Context key a node added, changed or removed.
+// Before is nil for ChangeAdded and After is nil for ChangeRemoved.
+type Change struct {
+	Key    string
+	Kind   ChangeKind
+	Before any
+	After  any
+}
+
+// RecordChanges controls whether runs record, for every Step, the Context
+// keys the node added, changed and removed (Step.Changes), and keep a copy
+// of the input Context (Trace.Initial) so Trace.ContextAt can rebuild the
+// Context as it was after any step.
+//
+// Recording costs a shallow copy of the Context per step, so it is off by
+// default. Values are compared with reflect.DeepEqual but not deep-copied:
+// a node that mutates a slice or map already stored in the Context, rather
+// than storing a new one, is not seen as changing it.
+// Returns the Engine for chaining.
+//
+//	engine := illygen.NewEngine().RecordChanges(true)
+//	trace, _ := engine.RunTrace(flow, ctx)
+//	for _, step := range trace.Steps {
+//	    for _, c := range step.Changes {
+//	        fmt.Printf("%s %s %q: %v → %v\n", step.NodeID, c.Kind, c.Key, c.Before, c.After)
+//	    }
+//	}
+func (e *Engine) RecordChanges(on bool) *Engine {
+	e.recordChanges = on
+	return e
+}
+
+// ContextAt returns the Context as it was after step i ran, rebuilt from
+// Trace.Initial and the Changes of steps 0 through i. Use Trace.Initial for
+// the Context before the first step.
+// Returns nil if i is out of range or the run did not record changes.
+func (t *Trace) ContextAt(i int) Context {
+	if t.Initial == nil || i < 0 || i >= len(t.Steps) {
+		return nil
+	}
+	ctx := t.Initial.clone()
+	for _, step := range t.Steps[:i+1] {
+		for _, c := range step.Changes {
+			if c.Kind == ChangeRemoved {
+				delete(ctx, c.Key)
+			} else {
+				ctx[c.Key] = c.After
+			}
+		}
+	}
+	return ctx
+}
+
+// snapshot returns a shallow copy of the context without internal keys.
+func (c Context) snapshot() Context {
+	s := c.clone()
+	s.stripInternal()
+	return s
+}
+
+// diffContext returns the changes that turn before into after, sorted by key.
+// Internal keys are ignored.
+func diffContext(before, after Context) []Change {
+	var changes []Change
+	for k, b := range before {
+		if internalKey(k) {
+			continue
+		}
+		a, ok := after[k]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Key: k, Kind: ChangeRemoved, Before: b})
+		case !reflect.DeepEqual(a, b):
+			changes = append(changes, Change{Key: k, Kind: ChangeChanged, Before: b, After: a})
+		}
+	}
+	for k, a := range after {
+		if internalKey(k) {
+			continue
+		}
+		if _, ok := before[k]; !ok {
+			changes = append(changes, Change{Key: k, Kind: ChangeAdded, After: a})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
@@ -0,0 +1,15 @@
+package illygen
+
+import "encoding/gob"
+
+// Checkpoints and Recordings are encoded with encoding/gob, which must know
+// every concrete type it meets behind an interface. Register the shapes
+// Context values commonly take — JSON-decoded objects and lists included —
+// so only the caller's own types need gob.Register.
+func init() {
+	gob.Register([]any{})
+	gob.Register(map[string]any{})
+	gob.Register([]map[string]any{})
+	gob.Register(Context{})
+	gob.Register(Result{})
+}
@@ -1,16 +1,20 @@
 package illygen
 
 import (
-	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/leraniode/illygen/internal/graph"
 	"github.com/leraniode/illygen/internal/runtime"
 )
 
 // Engine is the execution core of Illygen.
 // It runs flows, walks the node graph, and returns the final Result.
 //
-// An Engine is stateless and safe to reuse across multiple flows
-// and concurrent goroutines. Create one and share it freely.
+// An Engine is safe to reuse across multiple flows and concurrent
+// goroutines. Configure it once, before the first Run, then share it freely.
 //
 // Example:
 //
@@ -19,6 +23,20 @@ import (
 //	fmt.Println(result.Value)
 type Engine struct {
 	knowledge *KnowledgeStore
+	strategy  Strategy
+	rnd       *lockedRand
+	limits    Limits
+	isolate   bool
+
+	recordChanges bool
+	recordRuns    bool
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*Session
+
+	middleware []Middleware
+	hooks      []Hooks
+	runs       atomic.Uint64
 }
 
 // NewEngine creates a new Engine.
@@ -28,83 +46,321 @@ type Engine struct {
 //	engine := illygen.NewEngine()          // no knowledge
 //	engine := illygen.NewEngine(store)     // with knowledge
 func NewEngine(store ...*KnowledgeStore) *Engine {
-	e := &Engine{}
+	e := &Engine{
+		strategy: Greedy(),
+		rnd:      newLockedRand(time.Now().UnixNano()),
+		sessions: make(map[string]*Session),
+	}
 	if len(store) > 0 {
 		e.knowledge = store[0]
 	}
 	return e
 }
 
+// Routing sets the Strategy used to pick an outgoing Link when a node
+// leaves Result.Next empty. The default is Greedy.
+// A nil Strategy restores the default.
+// Returns the Engine for chaining.
+//
+//	engine := illygen.NewEngine().Routing(illygen.EpsilonGreedy(0.1))
+func (e *Engine) Routing(s Strategy) *Engine {
+	if s == nil {
+		s = Greedy()
+	}
+	e.strategy = s
+	return e
+}
+
+// Seed reseeds the random source handed to the routing Strategy.
+// Two engines with the same seed, flow and inputs route identically
+// when runs are made one at a time — use it to make tests reproducible.
+// Returns the Engine for chaining.
+func (e *Engine) Seed(seed int64) *Engine {
+	e.rnd = newLockedRand(seed)
+	return e
+}
+
+// Limits sets the execution limits applied to every run.
+// The zero Limits keeps the defaults: a 50-visit cycle guard and no other bounds.
+// Returns the Engine for chaining.
+func (e *Engine) Limits(l Limits) *Engine {
+	e.limits = l
+	return e
+}
+
+// Isolate controls whether runs work on a private copy of the caller's Context.
+//
+// By default the engine passes the caller's Context to nodes as is: their
+// writes land in the caller's map. That makes it unsafe to share one Context
+// between concurrent runs. The engine's internal keys, such as the knowledge
+// handle, are removed from the Context when every run ends, isolated or not.
+//
+// With Isolate(true), each run starts from a deep copy of the caller's
+// Context and never writes to the original: maps, slices and arrays are
+// copied all the way down, so nodes may mutate nested values freely. Values
+// behind pointers, and structs, channels and functions, are still shared —
+// nodes must not mutate them. The final Context is returned in Trace.Context.
+//
+// The copy is made once per run, using reflection for maps, slices and
+// arrays, so its cost grows with the total size of the Context's nested
+// values: keep large, read-only data out of the Context (in knowledge or
+// session memory, say) when isolating runs on a hot path.
+// Returns the Engine for chaining.
+//
+//	engine := illygen.NewEngine(store).Isolate(true)
+//	trace, _ := engine.RunTrace(flow, shared) // shared is left untouched
+//	fmt.Println(trace.Context.String("intent"))
+func (e *Engine) Isolate(on bool) *Engine {
+	e.isolate = on
+	return e
+}
+
 // Run executes a flow with the given context and returns the final Result.
 //
 // Execution starts at the flow's entry node and walks the graph:
 //   - If a node's Result specifies Next, that node is consulted next.
-//   - If Next is empty, the engine follows the highest-weight Link.
+//   - If Next is empty, the engine's routing Strategy picks a Link
+//     (by default, the highest-weight one).
 //   - Execution stops when there is no next node.
 //
 // A nil Context is treated as an empty Context — no panic.
 // Run is safe to call concurrently from multiple goroutines.
+//
+// If the run exceeds the engine's Limits, the error is a *CycleError,
+// *StepLimitError, *TimeoutError or *NodeTimeoutError. If the flow declares
+// Inputs and ctx does not satisfy them, the error joins a *SchemaError for
+// each problem (see Flow.Inputs).
 func (e *Engine) Run(flow *Flow, ctx Context) (Result, error) {
-	// Guard against nil context — treat it as empty rather than panicking.
-	if ctx == nil {
-		ctx = Context{}
+	trace, err := e.RunTrace(flow, ctx)
+	if err != nil {
+		return Result{}, err
 	}
+	return trace.Result, nil
+}
 
-	// Inject knowledge store into context so nodes can access it.
-	if e.knowledge != nil {
-		ctx.Set("__knowledge__", e.knowledge)
+// RunTrace executes a flow exactly like Run, but returns the full Trace
+// of the run — every node visited and how each route was chosen.
+//
+// Use it when you want to inspect a run or give feedback on it:
+//
+//	trace, err := engine.RunTrace(flow, ctx)
+//	// ... later, once the user has reacted to trace.Result:
+//	flow.Feedback(trace, 1.0)
+func (e *Engine) RunTrace(flow *Flow, ctx Context) (*Trace, error) {
+	return e.runTrace(flow, ctx, runOptions{})
+}
+
+// runOptions configures how runTrace starts a run.
+type runOptions struct {
+	session *Session    // the run belongs to a Session
+	resume  *checkpoint // continue a suspended run
+	replay  *replayRun  // replay a Recording
+}
+
+// runTrace is RunTrace, optionally within a Session.
+func (e *Engine) runTrace(flow *Flow, ctx Context, o runOptions) (trace *Trace, err error) {
+	ctx = e.runContext(ctx, o.session)
+	state := ctx.run()
+	resume := o.resume
+
+	run := &RunInfo{ID: e.runs.Add(1), Flow: flow, Context: ctx, Start: time.Now()}
+	if e.recordRuns && resume == nil {
+		run.Recording = &Recording{Flow: flow.name, Input: ctx.snapshot()}
+		state.entropy.startRecording()
+	}
+	if o.replay != nil {
+		o.replay.entropy = state.entropy
+		state.entropy.replayFrom(o.replay.recording.Steps)
 	}
 
-	// Resolve entry node.
-	entry, err := flow.entryNode()
-	if err != nil {
-		return Result{}, err
+	var steps []Step
+	e.runStart(run)
+	defer func() {
+		if o.replay != nil {
+			o.replay.steps = steps
+		}
+		if run.Recording != nil {
+			run.Recording.finish(steps, state.entropy.recorded(), trace, err)
+			if trace != nil {
+				trace.Recording = run.Recording
+			}
+		}
+		e.runEnd(run, trace, err)
+
+		// The run's state must not outlive it: a caller reusing ctx for
+		// another run would see, and race on, this one's memory.
+		state.end()
+		ctx.stripInternal()
+	}()
+
+	// Resolve where to start: the entry node, or where a suspended run stopped.
+	opts := runtime.Options{Limits: e.limits.runtimeLimits()}
+	var start string
+	var initial Context
+	if resume == nil {
+		entry, err := flow.entryNode()
+		if err != nil {
+			return nil, err
+		}
+
+		// Check the input Context against the flow's declared inputs, if any.
+		if err := flow.validateInputs(ctx); err != nil {
+			return nil, err
+		}
+
+		start = entry.ID()
+		if e.recordChanges {
+			initial = ctx.snapshot()
+		}
+	} else {
+		state.restore(resume)
+		start, initial = resume.Next, resume.Initial
+		opts.Visits, opts.Taken = resume.Visits, len(resume.Steps)
+	}
+
+	// prepare runs before each node, on this goroutine: the executor may be
+	// abandoned on another one if the node times out.
+	var before, nodeCtx Context
+	opts.Prepare = func(nodeID string) {
+		if e.recordChanges {
+			before = ctx.snapshot()
+		}
+		// A node that may time out runs on a private copy of the Context,
+		// so once abandoned it cannot write to a Context the engine and the
+		// caller are still using.
+		nodeCtx = ctx
+		if e.limits.timed() {
+			nodeCtx = ctx.clone()
+		}
+		state.enter(nodeID)
 	}
 
 	// executor bridges the internal runtime with the public illygen types.
-	executor := func(nodeID string) (any, float64, string, error) {
+	executor := func(nodeID string) (runtime.Step, error) {
 		node, err := flow.node(nodeID)
 		if err != nil {
-			return nil, 0, "", err
+			return runtime.Step{}, err
 		}
 
-		result := node.execute(ctx)
+		var data stepData
+		if e.limits.timed() {
+			data.ctx = nodeCtx
+		}
+		result := e.wrap(node)(nodeCtx)
+
+		data.knowledge, data.accesses = state.takeAudit()
+		if e.recordChanges {
+			data.changes = diffContext(before, nodeCtx)
+		}
 
-		// Result.Next takes priority. If not set, follow the highest-weight link.
-		next := result.Next
+		// Result.Next takes priority. If not set, let the strategy pick a link.
+		// The links are recorded as they are now, so the run can be explained
+		// later however the weights have moved on.
+		if edges := flow.graph.From(nodeID); len(edges) > 0 {
+			data.links = publicEdges(edges)
+		}
+		next, route := result.Next, RouteNext
 		if next == "" {
-			if edges := flow.graph.From(nodeID); len(edges) > 0 {
-				next = edges[0].To // graph returns edges sorted by weight desc
+			route = RouteEnd
+			if len(data.links) > 0 {
+				next = e.strategy.Choose(nodeID, slices.Clone(data.links), state.entropy).To
+				route = RouteLink
+				data.strategy = strategyName(e.strategy)
 			}
 		}
 
 		// Validate that the next node was registered in this flow.
 		if next != "" {
 			if _, err := flow.node(next); err != nil {
-				return nil, 0, "", fmt.Errorf(
-					"illygen: node %q routed to %q which is not in the flow — did you call flow.Add()?",
-					nodeID, next,
-				)
+				return runtime.Step{}, &RouteError{NodeID: nodeID, Next: next}
 			}
 		}
 
-		return result.Value, result.Confidence, next, nil
+		return runtime.Step{
+			Value:      result.Value,
+			Confidence: result.Confidence,
+			Next:       next,
+			Route:      string(route),
+			Suspend:    result.Suspend,
+			Data:       data,
+		}, nil
 	}
 
-	trace, err := runtime.Execute(entry.ID(), executor)
+	opts.OnStep = func(s runtime.Step) {
+		if data, _ := s.Data.(stepData); data.ctx != nil {
+			ctx.replace(data.ctx)
+		}
+		step := publicStep(s)
+		steps = append(steps, step)
+		e.step(run, step)
+	}
+	rt, err := runtime.Execute(start, executor, opts)
 	if err != nil {
-		return Result{}, err
+		return nil, limitError(err)
+	}
+
+	trace = newTrace(rt)
+	if resume != nil {
+		trace.Steps = append(resume.Steps, trace.Steps...)
+	}
+	if !rt.Done {
+		trace.Suspended = true
+		trace.checkpoint = state.suspend(flow, rt.Final.Next, rt.Visits, trace.Steps, ctx, initial)
+	}
+	trace.Flow = flow.name
+	trace.Context = ctx
+	trace.Initial = initial
+	return trace, nil
+}
+
+// runContext prepares the Context a run's nodes will see: never nil,
+// copied when the engine is isolated, and holding the run's state
+// (knowledge handle and memory).
+func (e *Engine) runContext(ctx Context, session *Session) Context {
+	// Guard against nil context — treat it as empty rather than panicking.
+	if ctx == nil {
+		ctx = Context{}
+	} else if e.isolate {
+		ctx = ctx.deepClone()
+	}
+
+	// Inject run state into context so nodes can reach knowledge and memory.
+	// Nodes query a snapshot, so writes made while the run is in progress
+	// never show halfway through it.
+	var knowledge *KnowledgeStore
+	var release func()
+	if e.knowledge != nil {
+		knowledge, release = e.knowledge.pin()
+	}
+	state := newRunState(knowledge, session, newEntropy(e.rnd))
+	state.release = release
+	ctx.Set(runKey, state)
+	return ctx
+}
+
+// publicEdges converts graph edges (sorted by weight desc) into Edges.
+func publicEdges(edges []*graph.Edge) []Edge {
+	out := make([]Edge, len(edges))
+	for i, e := range edges {
+		out[i] = publicEdge(e)
 	}
+	return out
+}
 
-	return Result{
-		Value:      trace.Final.Value,
-		Confidence: trace.Final.Confidence,
-	}, nil
+func publicEdge(e *graph.Edge) Edge {
+	edge := Edge{From: e.From, To: e.To, Weight: e.Weight, Pulls: e.Pulls}
+	if e.Pulls > 0 {
+		edge.MeanReward = e.Reward / float64(e.Pulls)
+	}
+	return edge
 }
 
 // Knowledge returns the KnowledgeStore attached to this engine's context.
 // Call this inside a NodeFunc to query knowledge by domain.
+// Units returned by its queries are listed in the step's Step.Knowledge.
 //
+// The store is a read-only Snapshot taken when the run started: every node
+// of the run sees the same knowledge, whatever is written meanwhile.
 // Returns nil if no KnowledgeStore was attached to the engine.
 //
 // Example:
@@ -114,6 +370,8 @@ func (e *Engine) Run(flow *Flow, ctx Context) (Result, error) {
 //	    // ...
 //	})
 func Knowledge(ctx Context) *KnowledgeStore {
-	store, _ := ctx.Get("__knowledge__").(*KnowledgeStore)
-	return store
+	if s := ctx.run(); s != nil {
+		return s.knowledge
+	}
+	return nil
 }
@@ -18,9 +18,21 @@ import (
 	illygen "github.com/leraniode/illygen"
 )
 
+// Context keys shared by the nodes below. Declaring them once makes
+// the contract between nodes explicit and lets flow.Validate check it.
+var (
+	Text   = illygen.NewKey[string]("text")
+	Intent = illygen.NewKey[string]("intent")
+	Query  = illygen.NewKey[string]("query")
+)
+
 func main() {
 	// ── Knowledge ──────────────────────────────────────────────────
-	store := illygen.NewKnowledgeStore()
+	store := illygen.NewKnowledgeStore().
+		Schema("facts", illygen.FactSchema{
+			"topic":    illygen.FactOf[string]().OneOf("illygen", "node", "flow"),
+			"response": illygen.FactOf[string](),
+		})
 
 	_ = store.Add("greet-1", "greetings", map[string]any{
 		"response": "Hi! I'm Illygen — a lightweight intelligence engine. How can I help?",
@@ -48,28 +60,28 @@ func main() {
 
 	// InputNode: classifies the user's intent and routes accordingly
 	inputNode := illygen.NewNode("input", func(ctx illygen.Context) illygen.Result {
-		text := strings.ToLower(strings.TrimSpace(ctx.String("text")))
+		text := strings.ToLower(strings.TrimSpace(Text.MustGet(ctx)))
 
 		switch {
 		case isGreeting(text):
-			ctx.Set("intent", "greeting")
+			Intent.Set(ctx, "greeting")
 			return illygen.Result{Next: "action", Confidence: 0.95}
 		case isFarewell(text):
-			ctx.Set("intent", "farewell")
+			Intent.Set(ctx, "farewell")
 			return illygen.Result{Next: "action", Confidence: 0.95}
 		case isQuestion(text):
-			ctx.Set("intent", "question")
-			ctx.Set("query", text)
+			Intent.Set(ctx, "question")
+			Query.Set(ctx, text)
 			return illygen.Result{Next: "action", Confidence: 0.80}
 		default:
-			ctx.Set("intent", "unknown")
+			Intent.Set(ctx, "unknown")
 			return illygen.Result{Next: "action", Confidence: 0.30}
 		}
-	})
+	}).Reads(Text.Field()).Writes(Intent.Field(), Query.Field())
 
 	// ActionNode: uses intent + knowledge to build the response
 	actionNode := illygen.NewNode("action", func(ctx illygen.Context) illygen.Result {
-		intent := ctx.String("intent")
+		intent, _ := Intent.Get(ctx)
 		store := illygen.Knowledge(ctx)
 
 		switch intent {
@@ -93,10 +105,10 @@ func main() {
 			}
 
 		case "question":
-			query := ctx.String("query")
+			query, _ := Query.Get(ctx)
 			units := store.Domain("facts")
 			for _, unit := range units {
-				topic, _ := unit.Fact("topic").(string)
+				topic, _ := unit.FactString("topic")
 				if topic != "" && strings.Contains(query, topic) {
 					return illygen.Result{
 						Value:      unit.Fact("response"),
@@ -114,13 +126,20 @@ func main() {
 			Value:      "I'm not sure how to respond to that. Try asking about Illygen, nodes, or flows.",
 			Confidence: 0.20,
 		}
-	})
+	}).Reads(Intent.Field(), Query.Optional())
 
 	// ── Flow ───────────────────────────────────────────────────────
 	flow := illygen.NewFlow().
 		Add(inputNode).
 		Add(actionNode).
-		Link("input", "action", 1.0)
+		Link("input", "action", 1.0).
+		Inputs(Text.Field())
+
+	// Catch typos in Context keys before the first message, not in answers.
+	if err := flow.Validate(); err != nil {
+		fmt.Println("Invalid flow:", err)
+		os.Exit(1)
+	}
 
 	// ── Engine ─────────────────────────────────────────────────────
 	engine := illygen.NewEngine(store)
@@ -150,7 +169,9 @@ func main() {
 			break
 		}
 
-		result, err := engine.Run(flow, illygen.Context{"text": text})
+		ctx := illygen.Context{}
+		Text.Set(ctx, text)
+		result, err := engine.Run(flow, ctx)
 		if err != nil {
 			fmt.Println("Error:", err)
 			continue
@@ -0,0 +1,169 @@
+package illygen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Choice is why the engine moved from one node to the next, as reported
+// by an Explanation.
+type Choice string
+
+const (
+	// ChoiceNext means the node set Result.Next explicitly.
+	ChoiceNext Choice = "explicit-next"
+
+	// ChoiceHighestWeight means the node left Result.Next empty and the
+	// Greedy strategy followed its highest-weight Link.
+	ChoiceHighestWeight Choice = "highest-weight"
+
+	// ChoiceStrategy means a routing Strategy other than Greedy picked the
+	// highest-weight Link — by sampling or by its own score, so not
+	// necessarily because of the weight.
+	ChoiceStrategy Choice = "strategy"
+
+	// ChoiceExplored means the routing Strategy picked a Link other than
+	// the highest-weight one — Softmax, EpsilonGreedy or a bandit exploring.
+	ChoiceExplored Choice = "explored"
+
+	// ChoiceEnd means the run ended at the node.
+	ChoiceEnd Choice = "end"
+)
+
+// Explanation is a human-readable rationale for a run: the path it took,
+// why each Link was chosen, which knowledge each node consulted and how
+// each step moved the confidence. Get one from Trace.Explain.
+//
+// It renders as plain text with String and as JSON with WriteJSON or
+// encoding/json.
+type Explanation struct {
+	Flow  string            `json:"flow,omitempty"`
+	Path  []string          `json:"path"`
+	Steps []StepExplanation `json:"steps"`
+
+	// Value and Confidence are the run's Result.
+	Value      any     `json:"value"`
+	Confidence float64 `json:"confidence"`
+}
+
+// StepExplanation explains a single step of a run.
+type StepExplanation struct {
+	NodeID     string  `json:"node"`
+	Value      any     `json:"value,omitempty"`
+	Confidence float64 `json:"confidence"`
+
+	// Contribution is how much the step moved the confidence, compared
+	// with the step before it (or with 0 for the first step).
+	Contribution float64 `json:"contribution"`
+
+	// Knowledge lists the KnowledgeUnits the node consulted.
+	Knowledge []string `json:"knowledge,omitempty"`
+
+	// Next is the node the run moved to, Choice why, and Weight the weight
+	// the Link followed had when the step ran (0 if there was no such Link).
+	// Links is how many outgoing Links the node had to choose from.
+	Next   string  `json:"next,omitempty"`
+	Choice Choice  `json:"choice"`
+	Weight float64 `json:"weight,omitempty"`
+	Links  int     `json:"links"`
+
+	// Reason explains the choice in a sentence.
+	Reason string `json:"reason"`
+}
+
+// Explain builds an Explanation of the run from its Trace alone: the Link
+// weights and routing choices it reports are those recorded when each step
+// ran, not the flow's current ones.
+//
+//	trace, _ := engine.RunTrace(flow, ctx)
+//	fmt.Print(trace.Explain())
+func (t *Trace) Explain() *Explanation {
+	x := &Explanation{
+		Flow:       t.Flow,
+		Path:       make([]string, len(t.Steps)),
+		Steps:      make([]StepExplanation, len(t.Steps)),
+		Value:      t.Result.Value,
+		Confidence: t.Result.Confidence,
+	}
+
+	var prev float64
+	for i, step := range t.Steps {
+		edges := step.Links
+		se := StepExplanation{
+			NodeID:       step.NodeID,
+			Value:        step.Value,
+			Confidence:   step.Confidence,
+			Contribution: step.Confidence - prev,
+			Knowledge:    step.Knowledge,
+			Next:         step.Next,
+			Links:        len(edges),
+		}
+		prev = step.Confidence
+
+		for _, edge := range edges {
+			if edge.To == step.Next {
+				se.Weight = edge.Weight
+				break
+			}
+		}
+
+		switch {
+		case step.Route == RouteNext:
+			se.Choice = ChoiceNext
+			se.Reason = fmt.Sprintf("set Next to %q explicitly", step.Next)
+		case step.Route == RouteEnd || step.Next == "" || len(edges) == 0:
+			se.Choice = ChoiceEnd
+			se.Reason = "ended the run: no Next and no outgoing links"
+		case se.Weight < edges[0].Weight:
+			se.Choice = ChoiceExplored
+			se.Reason = fmt.Sprintf("the %s strategy explored the link to %q (weight %.2f) over the highest-weight link to %q (weight %.2f)",
+				step.Strategy, step.Next, se.Weight, edges[0].To, edges[0].Weight)
+		case step.Strategy == "greedy":
+			se.Choice = ChoiceHighestWeight
+			se.Reason = fmt.Sprintf("followed the highest-weight link to %q (weight %.2f, %s)",
+				step.Next, se.Weight, plural(len(edges), "link"))
+		default:
+			se.Choice = ChoiceStrategy
+			se.Reason = fmt.Sprintf("the %s strategy picked the link to %q, which has the highest weight (%.2f, %s)",
+				step.Strategy, step.Next, se.Weight, plural(len(edges), "link"))
+		}
+
+		x.Path[i] = step.NodeID
+		x.Steps[i] = se
+	}
+	return x
+}
+
+// String renders the explanation as plain text.
+func (x *Explanation) String() string {
+	var b strings.Builder
+	if x.Flow != "" {
+		fmt.Fprintf(&b, "Flow %q: ", x.Flow)
+	}
+	fmt.Fprintf(&b, "%s\n", strings.Join(x.Path, " → "))
+	for i, s := range x.Steps {
+		fmt.Fprintf(&b, "  %d. %s (confidence %.2f, %+.2f)\n", i+1, s.NodeID, s.Confidence, s.Contribution)
+		if len(s.Knowledge) > 0 {
+			fmt.Fprintf(&b, "     consulted %s\n", strings.Join(s.Knowledge, ", "))
+		}
+		fmt.Fprintf(&b, "     %s\n", s.Reason)
+	}
+	fmt.Fprintf(&b, "Result: %v (confidence %.2f)\n", x.Value, x.Confidence)
+	return b.String()
+}
+
+// WriteJSON writes the explanation to w as indented JSON.
+func (x *Explanation) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(x)
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,231 @@
+package illygen
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+)
+
+// FactSchema declares the facts the units of a domain must have, by fact
+// key. Keys the schema does not mention are allowed. Attach one to a
+// domain with KnowledgeStore.Schema.
+//
+//	store.Schema("facts", illygen.FactSchema{
+//	    "response": illygen.FactOf[string](),
+//	    "topic":    illygen.FactOf[string]().OneOf("illygen", "node", "flow"),
+//	    "keywords": illygen.FactOf[[]string]().Optional(),
+//	    "score":    illygen.FactOf[float64]().Between(0, 1).Optional(),
+//	})
+type FactSchema map[string]FactRule
+
+// FactRule constrains one fact of a FactSchema. Build one with FactOf.
+type FactRule struct {
+	typ      reflect.Type
+	optional bool
+	oneOf    []any
+	bounded  bool
+	min, max float64
+}
+
+// FactOf declares a required fact of type T. An interface type (such as
+// any) accepts every value that implements it, numbers convert as they do
+// for Key.Get, and a slice type also accepts a []any whose elements it
+// would accept one by one, as decoded from JSON — so FactOf[[]string]()
+// accepts what KnowledgeUnit.FactStrings returns.
+func FactOf[T any]() FactRule {
+	return FactRule{typ: reflect.TypeOf((*T)(nil)).Elem()}
+}
+
+// Optional lets units leave the fact out. Facts that are present are
+// still checked.
+func (r FactRule) Optional() FactRule {
+	r.optional = true
+	return r
+}
+
+// OneOf restricts the fact to the given values. Numbers match by value
+// whatever their type, so OneOf(1, 2) accepts float64(1), as decoded
+// from JSON.
+func (r FactRule) OneOf(values ...any) FactRule {
+	r.oneOf = values
+	return r
+}
+
+// Between restricts a numeric fact to min–max, inclusive.
+func (r FactRule) Between(min, max float64) FactRule {
+	r.bounded, r.min, r.max = true, min, max
+	return r
+}
+
+// FactError describes a fact that breaks its domain's FactSchema, or that
+// a typed accessor such as KnowledgeUnit.FactString could not return.
+// Several FactErrors are combined with errors.Join; use errors.As to
+// inspect the first one.
+type FactError struct {
+	// ID is the unit concerned.
+	ID string
+
+	// Key is the fact key concerned.
+	Key string
+
+	// Problem describes what is wrong.
+	Problem string
+}
+
+func (e *FactError) Error() string {
+	return fmt.Sprintf("illygen: knowledge unit %q fact %q %s", e.ID, e.Key, e.Problem)
+}
+
+// Schema makes every unit added to or updated in domain conform to schema;
+// Add, Train, Update and batches fail with FactErrors otherwise. Units
+// already stored, and units restored by Revert, are not checked.
+// A nil schema removes the domain's schema.
+// Returns the KnowledgeStore for chaining.
+func (s *KnowledgeStore) Schema(domain string, schema FactSchema) *KnowledgeStore {
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+	if schema == nil {
+		delete(s.base.schemas, domain)
+	} else {
+		s.base.schemas[domain] = schema
+	}
+	return s
+}
+
+// checkFacts checks a unit's facts against its domain's schema, returning
+// every FactError joined. The caller must hold b.mu.
+func (b *knowledgeBase) checkFacts(u *KnowledgeUnit) error {
+	schema := b.schemas[u.Domain]
+	keys := make([]string, 0, len(schema))
+	for key := range schema {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		if problem := schema[key].check(u.Facts, key); problem != "" {
+			errs = append(errs, &FactError{ID: u.ID, Key: key, Problem: problem})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// check returns what is wrong with facts[key], or "".
+func (r FactRule) check(facts map[string]any, key string) string {
+	v, ok := facts[key]
+	if !ok {
+		if r.optional {
+			return ""
+		}
+		return "is missing"
+	}
+	if !factAccepts(r.typ, v) {
+		return fmt.Sprintf("is a %T, want %s", v, r.typ)
+	}
+	if r.oneOf != nil && !slices.ContainsFunc(r.oneOf, func(o any) bool { return factEqual(o, v) }) {
+		return fmt.Sprintf("is %v, want one of %v", v, r.oneOf)
+	}
+	if r.bounded {
+		f, ok := ToFloat(v)
+		if !ok {
+			return fmt.Sprintf("is a %T, want a number", v)
+		}
+		if f < r.min || f > r.max {
+			return fmt.Sprintf("is %v, want %g to %g", v, r.min, r.max)
+		}
+	}
+	return ""
+}
+
+// factAccepts reports whether v is a valid value of type typ for a fact:
+// as for a Field, or, for a slice type, a []any of valid elements.
+func factAccepts(typ reflect.Type, v any) bool {
+	if (Field{Type: typ}).accepts(v) {
+		return true
+	}
+	list, ok := v.([]any)
+	if !ok || typ.Kind() != reflect.Slice {
+		return false
+	}
+	for _, e := range list {
+		if !factAccepts(typ.Elem(), e) {
+			return false
+		}
+	}
+	return true
+}
+
+// factEqual reports whether the fact value v matches want, comparing
+// numbers by value.
+func factEqual(want, v any) bool {
+	if n, ok := convertNumber(v, reflect.TypeOf(want)); ok {
+		return n.Interface() == want
+	}
+	return reflect.DeepEqual(want, v)
+}
+
+// FactString returns a fact that must be a string.
+// Returns a *FactError if it is missing or is not a string.
+func (u *KnowledgeUnit) FactString(key string) (string, error) {
+	v, err := u.fact(key)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", &FactError{ID: u.ID, Key: key, Problem: fmt.Sprintf("is a %T, want string", v)}
+	}
+	return s, nil
+}
+
+// FactStrings returns a fact that must be a list of strings: a []string,
+// or a []any holding only strings, as decoded from JSON.
+// Returns a *FactError if it is missing or is not a list of strings.
+func (u *KnowledgeUnit) FactStrings(key string) ([]string, error) {
+	v, err := u.fact(key)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case []string:
+		return v, nil
+	case []any:
+		out := make([]string, len(v))
+		for i, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, &FactError{ID: u.ID, Key: key, Problem: fmt.Sprintf("holds a %T at %d, want string", e, i)}
+			}
+			out[i] = s
+		}
+		return out, nil
+	}
+	return nil, &FactError{ID: u.ID, Key: key, Problem: fmt.Sprintf("is a %T, want []string", v)}
+}
+
+// FactFloat returns a fact that must be a number of any Go numeric type,
+// converted to a float64.
+// Returns a *FactError if it is missing or is not a number.
+func (u *KnowledgeUnit) FactFloat(key string) (float64, error) {
+	v, err := u.fact(key)
+	if err != nil {
+		return 0, err
+	}
+	f, ok := ToFloat(v)
+	if !ok {
+		return 0, &FactError{ID: u.ID, Key: key, Problem: fmt.Sprintf("is a %T, want a number", v)}
+	}
+	return f, nil
+}
+
+// fact returns a fact that must be present.
+func (u *KnowledgeUnit) fact(key string) (any, error) {
+	v, ok := u.Facts[key]
+	if !ok {
+		return nil, &FactError{ID: u.ID, Key: key, Problem: "is missing"}
+	}
+	return v, nil
+}
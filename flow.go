@@ -1,7 +1,10 @@
 package illygen
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
 
 	"github.com/leraniode/illygen/internal/graph"
 )
@@ -17,9 +20,14 @@ import (
 //	    Add(outputNode).
 //	    Link("input", "output", 1.0)
 type Flow struct {
-	nodes map[string]*Node
-	graph *graph.Graph
-	entry string
+	name    string
+	version string
+	nodes   map[string]*Node
+	graph   *graph.Graph
+	entry   string
+
+	// inputs declares the Context keys callers supply, see Inputs.
+	inputs []Field
 }
 
 // NewFlow creates a new empty Flow.
@@ -46,7 +54,8 @@ func (f *Flow) Add(node *Node) *Flow {
 
 // Link connects two nodes with a weight.
 // Weight represents the strength of this connection (0.0 to 1.0).
-// Higher weight connections are preferred by the engine.
+// The engine's routing Strategy weighs Links when a node leaves
+// Result.Next empty; the default, Greedy, follows the heaviest.
 // Returns the Flow for chaining.
 func (f *Flow) Link(from, to string, weight float64) *Flow {
 	if err := f.graph.Add(from, to, weight); err != nil {
@@ -63,6 +72,30 @@ func (f *Flow) Entry(nodeID string) *Flow {
 	return f
 }
 
+// Named gives the flow a name. Metrics and tracing report runs under it;
+// unnamed flows all share the empty name.
+// Returns the Flow for chaining.
+func (f *Flow) Named(name string) *Flow {
+	f.name = name
+	return f
+}
+
+// Name returns the name set with Named.
+func (f *Flow) Name() string {
+	return f.name
+}
+
+// RouteError is returned when a node routes, through Result.Next or a
+// Link, to a node that is not in the flow.
+type RouteError struct {
+	NodeID string // the node that routed
+	Next   string // the missing node
+}
+
+func (e *RouteError) Error() string {
+	return fmt.Sprintf("illygen: node %q routed to %q which is not in the flow — did you call flow.Add()?", e.NodeID, e.Next)
+}
+
 // node retrieves a node by ID. Returns an error if not found.
 func (f *Flow) node(id string) (*Node, error) {
 	n, ok := f.nodes[id]
@@ -79,3 +112,89 @@ func (f *Flow) entryNode() (*Node, error) {
 	}
 	return f.node(f.entry)
 }
+
+// Edges returns the outgoing Links of a node, sorted by weight descending,
+// together with the feedback statistics recorded for each.
+func (f *Flow) Edges(from string) []Edge {
+	return publicEdges(f.graph.From(from))
+}
+
+// Feedback rewards every Link the engine followed during the traced run.
+// Only steps routed by the flow graph (RouteLink) are credited — a node that
+// set Result.Next explicitly made its own choice.
+//
+// Rewards are usually in the range 0.0 (bad outcome) to 1.0 (good outcome);
+// bandit strategies such as UCB1 and ThompsonSampling assume that range.
+//
+//	trace, _ := engine.RunTrace(flow, ctx)
+//	flow.Feedback(trace, 1.0) // the user liked the answer
+func (f *Flow) Feedback(trace *Trace, reward float64) {
+	if trace == nil {
+		return
+	}
+	for _, step := range trace.Steps {
+		if step.Route == RouteLink {
+			f.graph.Reward(step.NodeID, step.Next, reward)
+		}
+	}
+}
+
+// edgeStats is the persisted form of a Link's feedback statistics.
+type edgeStats struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Pulls  int     `json:"pulls"`
+	Reward float64 `json:"reward"`
+}
+
+// SaveStats writes the feedback statistics of every Link as JSON,
+// so they can be persisted alongside the flow definition and restored
+// with LoadStats.
+func (f *Flow) SaveStats(w io.Writer) error {
+	edges := f.graph.All()
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+
+	stats := make([]edgeStats, 0, len(edges))
+	for _, e := range edges {
+		stats = append(stats, edgeStats{From: e.From, To: e.To, Pulls: e.Pulls, Reward: e.Reward})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(stats)
+}
+
+// LoadStats restores feedback statistics written by SaveStats.
+// Links must already exist in the flow — call it after Link.
+// Returns an error, and changes nothing, if the data references a Link
+// the flow does not have.
+func (f *Flow) LoadStats(r io.Reader) error {
+	var stats []edgeStats
+	if err := json.NewDecoder(r).Decode(&stats); err != nil {
+		return fmt.Errorf("illygen: Flow.LoadStats: %w", err)
+	}
+	for _, s := range stats {
+		if !f.hasLink(s.From, s.To) {
+			return fmt.Errorf("illygen: Flow.LoadStats: link %q → %q not in flow", s.From, s.To)
+		}
+	}
+	for _, s := range stats {
+		f.graph.SetStats(s.From, s.To, s.Pulls, s.Reward)
+	}
+	return nil
+}
+
+// hasLink reports whether the flow graph has a Link from → to.
+func (f *Flow) hasLink(from, to string) bool {
+	for _, e := range f.graph.From(from) {
+		if e.To == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,401 @@
+package illygen
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// VersionKind names the change that produced a KnowledgeVersion.
+type VersionKind string
+
+const (
+	// VersionAdded is a unit added with Add or Train.
+	VersionAdded VersionKind = "added"
+
+	// VersionUpdated is a change to a unit's facts or TTL.
+	VersionUpdated VersionKind = "updated"
+
+	// VersionReweighted is a weight change made by Reinforce.
+	VersionReweighted VersionKind = "reweighted"
+
+	// VersionDeleted is a unit removed with Delete. Its Unit is nil.
+	VersionDeleted VersionKind = "deleted"
+
+	// VersionExpired is a unit Sweep removed once its TTL ran out. Its
+	// Unit is nil; to retention and Revert it is a deletion like any other.
+	VersionExpired VersionKind = "expired"
+
+	// VersionReverted is a unit restored to an earlier version with Revert.
+	// Its Unit is nil if the version restored was a deletion.
+	VersionReverted VersionKind = "reverted"
+)
+
+// KnowledgeVersion is one state of a KnowledgeUnit, recorded every time the
+// unit changes. Get them from KnowledgeStore.History.
+type KnowledgeVersion struct {
+	// Version numbers the unit's versions from 1, oldest first.
+	Version int
+
+	// Unit is the unit as this change left it, nil if the change removed it.
+	Unit *KnowledgeUnit
+
+	// Time is when the change was made, by the store's Clock.
+	Time time.Time
+
+	// Author is who or what made the change — see KnowledgeStore.As.
+	// Empty if the change was made through a store with no author.
+	Author string
+
+	// Kind is the change made.
+	Kind VersionKind
+
+	seq uint64 // orders versions across the whole store
+}
+
+// As returns a handle on the same store that records author with every
+// change made through it, so a unit's History tells who changed it.
+// Queries and changes through the handle act on the shared store.
+//
+//	store.As("importer").Update("k1", facts)
+func (s *KnowledgeStore) As(author string) *KnowledgeStore {
+	v := *s
+	v.author = author
+	return &v
+}
+
+// AsOf returns a read-only view of the store as it was at t: queries
+// return the version of every unit current at t, with TTLs and decay
+// applied as of t. Changes through the view return an error, and
+// Reinforce changes nothing. Units whose version at t the store no longer
+// keeps (see Retain) are missing from the view.
+//
+// Sweep's write-backs of decayed weights are not changes; they do not
+// create versions and the view does not need them.
+//
+//	yesterday := store.AsOf(time.Now().Add(-24 * time.Hour))
+//	units := yesterday.Domain("promotions")
+func (s *KnowledgeStore) AsOf(t time.Time) *KnowledgeStore {
+	v := *s
+	v.past = true
+	v.at = t
+	return &v
+}
+
+// Snapshot returns a read-only view of the store as it is now, which
+// later changes to the store do not affect. TTLs and decay are frozen at
+// the time of the snapshot too. Taking a snapshot copies nothing, so it is
+// cheap; the engine takes one at the start of every run, so every node of
+// a run sees the same knowledge.
+//
+// A snapshot reads the store's history, so like AsOf it loses units whose
+// version it sees is later dropped by Retain. The engine's own snapshots
+// hold on to their versions until the run ends.
+//
+//	snap := store.Snapshot()
+//	before := snap.Domain("greetings")
+//	store.Add("g9", "greetings", facts) // snap does not see g9
+func (s *KnowledgeStore) Snapshot() *KnowledgeStore {
+	if s.past {
+		return s
+	}
+	s.base.mu.RLock()
+	defer s.base.mu.RUnlock()
+	return s.snapshot()
+}
+
+// snapshot is Snapshot. The caller must hold s.base.mu.
+func (s *KnowledgeStore) snapshot() *KnowledgeStore {
+	v := *s
+	v.past = true
+	v.at = s.base.clock.Now()
+	v.pinned = true
+	v.seq = s.base.seq
+	return &v
+}
+
+// pin is Snapshot for a run: until release is called, Retain keeps every
+// version the snapshot sees.
+func (s *KnowledgeStore) pin() (snap *KnowledgeStore, release func()) {
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+	snap = s.snapshot()
+	s.base.pins[snap.seq]++
+	var once sync.Once
+	return snap, func() {
+		once.Do(func() {
+			s.base.mu.Lock()
+			defer s.base.mu.Unlock()
+			if s.base.pins[snap.seq]--; s.base.pins[snap.seq] == 0 {
+				delete(s.base.pins, snap.seq)
+			}
+		})
+	}
+}
+
+// Retention bounds how much of each unit's History a KnowledgeStore keeps.
+// The zero value uses the defaults.
+type Retention struct {
+	// Versions caps the versions kept per unit, dropping the oldest first.
+	// Default 100; a negative Versions keeps every version.
+	Versions int
+
+	// MaxAge drops versions older than MaxAge, though never a unit's latest.
+	// Histories ending in a deletion older than MaxAge are dropped whole.
+	// 0 keeps versions whatever their age.
+	MaxAge time.Duration
+}
+
+func (r Retention) withDefaults() Retention {
+	if r.Versions == 0 {
+		r.Versions = 100
+	}
+	return r
+}
+
+// Retain sets how much history the store keeps. Every change trims the
+// changed unit's history; Compact, or Sweep, trims every unit's.
+// Versions that runs in progress can see are kept until the runs end.
+// Returns the KnowledgeStore for chaining.
+//
+//	store.Retain(illygen.Retention{Versions: 10, MaxAge: 30 * 24 * time.Hour})
+func (s *KnowledgeStore) Retain(r Retention) *KnowledgeStore {
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+	s.base.retention = r.withDefaults()
+	return s
+}
+
+// Compact trims the history of every unit to the store's Retention.
+// Returns the number of versions dropped.
+func (s *KnowledgeStore) Compact() int {
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+	return s.base.compact(s.base.clock.Now())
+}
+
+// compact trims every unit's history. The caller must hold b.mu for writing.
+func (b *knowledgeBase) compact(now time.Time) int {
+	dropped := 0
+	for id := range b.history {
+		dropped += b.trim(id, now)
+	}
+	return dropped
+}
+
+// trim drops the versions of unit id the Retention does not keep, and
+// returns how many it dropped. The caller must hold b.mu for writing.
+func (b *knowledgeBase) trim(id string, now time.Time) int {
+	versions := b.history[id]
+	n, r := len(versions), b.retention
+	keep := 0 // index of the oldest version kept
+	if r.Versions > 0 && n > r.Versions {
+		keep = n - r.Versions
+	}
+	if r.MaxAge > 0 {
+		for keep < n-1 && now.Sub(versions[keep].Time) > r.MaxAge {
+			keep++
+		}
+		if last := versions[n-1]; keep == n-1 && last.Unit == nil && now.Sub(last.Time) > r.MaxAge {
+			keep = n
+		}
+	}
+
+	// Keep the version the oldest pinned snapshot sees, and every later one.
+	if len(b.pins) > 0 {
+		oldest := uint64(math.MaxUint64)
+		for seq := range b.pins {
+			oldest = min(oldest, seq)
+		}
+		for i := min(keep, n-1); i >= 0; i-- {
+			if versions[i].seq <= oldest {
+				keep = min(keep, i)
+				break
+			}
+		}
+	}
+
+	if keep == 0 {
+		return 0
+	}
+	if keep == n {
+		delete(b.history, id)
+		return n
+	}
+	b.history[id] = slices.Clone(versions[keep:])
+	return keep
+}
+
+// History returns the versions of a unit the store keeps (see Retain),
+// oldest first — or, through an AsOf view or a Snapshot, those the view can
+// see. Versions of a unit that was deleted and added again run on from the
+// deleted one's. Returns nil if the unit never existed.
+func (s *KnowledgeStore) History(id string) []KnowledgeVersion {
+	s.base.mu.RLock()
+	defer s.base.mu.RUnlock()
+	var versions []KnowledgeVersion
+	for _, v := range s.base.history[id] {
+		if !s.sees(v) {
+			break
+		}
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// Update replaces the facts of a unit, keeping its weight and TTL. The new
+// facts must conform to the domain's FactSchema, if it has one.
+// Returns an error if the unit does not exist.
+func (s *KnowledgeStore) Update(id string, facts map[string]any) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+	old, ok := s.base.units[id]
+	if !ok {
+		return fmt.Errorf("illygen: knowledge unit %q not found", id)
+	}
+	u := *old
+	u.Facts = facts
+	if err := s.base.checkFacts(&u); err != nil {
+		return err
+	}
+	u.Updated = s.base.clock.Now()
+	s.commit(id, &u, VersionUpdated, u.Updated)
+	return nil
+}
+
+// Delete removes a unit from the store. Its history is kept, so it can
+// still be read through AsOf and snapshots, or brought back with Revert.
+// Returns an error if the unit does not exist.
+func (s *KnowledgeStore) Delete(id string) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+	if _, ok := s.base.units[id]; !ok {
+		return fmt.Errorf("illygen: knowledge unit %q not found", id)
+	}
+	s.commit(id, nil, VersionDeleted, s.base.clock.Now())
+	return nil
+}
+
+// Revert restores a unit to an earlier version, recording the restore as
+// a new version so it can itself be reverted. The restored unit counts as
+// just Updated, which restarts its TTL and decay. Reverting to a
+// VersionDeleted or VersionExpired version deletes the unit.
+// Returns an error if the unit has no such version, or no longer keeps it
+// (see Retain).
+//
+//	store.As("alice").Revert("k1", 2)
+func (s *KnowledgeStore) Revert(id string, version int) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+	i := slices.IndexFunc(s.base.history[id], func(v KnowledgeVersion) bool { return v.Version == version })
+	if i < 0 {
+		return fmt.Errorf("illygen: knowledge unit %q has no version %d", id, version)
+	}
+	now := s.base.clock.Now()
+	old := s.base.history[id][i].Unit
+	if old == nil {
+		s.commit(id, nil, VersionReverted, now)
+		return nil
+	}
+	u := *old
+	u.Updated = now
+	s.commit(id, &u, VersionReverted, now)
+	return nil
+}
+
+// writable returns an error if the handle is a read-only view.
+func (s *KnowledgeStore) writable() error {
+	switch {
+	case s.pinned:
+		return fmt.Errorf("illygen: knowledge store snapshot is read-only")
+	case s.past:
+		return fmt.Errorf("illygen: knowledge store as of %s is read-only", s.at.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// sees reports whether a version was made before the handle's view of the
+// store was taken. Current handles see every version.
+func (s *KnowledgeStore) sees(v KnowledgeVersion) bool {
+	switch {
+	case s.pinned:
+		return v.seq <= s.seq
+	case s.past:
+		return !v.Time.After(s.at)
+	}
+	return true
+}
+
+// now returns the time the handle's queries are answered at.
+func (s *KnowledgeStore) now() time.Time {
+	if s.past {
+		return s.at
+	}
+	return s.base.clock.Now()
+}
+
+// stored returns a unit as stored at the handle's time, before TTLs and
+// decay. The caller must hold s.base.mu.
+func (s *KnowledgeStore) stored(id string) (*KnowledgeUnit, bool) {
+	if !s.past {
+		u, ok := s.base.units[id]
+		return u, ok
+	}
+	versions := s.base.history[id]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if s.sees(versions[i]) {
+			return versions[i].Unit, versions[i].Unit != nil
+		}
+	}
+	return nil, false
+}
+
+// each calls fn with every unit stored at the handle's time, in no
+// particular order. The caller must hold s.base.mu.
+func (s *KnowledgeStore) each(fn func(u *KnowledgeUnit)) {
+	if !s.past {
+		for _, u := range s.base.units {
+			fn(u)
+		}
+		return
+	}
+	for id := range s.base.history {
+		if u, ok := s.stored(id); ok {
+			fn(u)
+		}
+	}
+}
+
+// commit makes u the current version of unit id — removing the unit if u
+// is nil — appends it to the unit's history and tells watchers. u must be
+// a new unit, never one already stored. The caller must hold s.base.mu for
+// writing.
+func (s *KnowledgeStore) commit(id string, u *KnowledgeUnit, kind VersionKind, now time.Time) {
+	versions := s.base.history[id]
+	s.base.seq++
+	v := KnowledgeVersion{Version: 1, Unit: u, Time: now, Author: s.author, Kind: kind, seq: s.base.seq}
+	if n := len(versions); n > 0 {
+		v.Version = versions[n-1].Version + 1
+	}
+	before := s.base.units[id]
+	if u != nil {
+		u.Version = v.Version
+		s.base.units[id] = u
+	} else {
+		delete(s.base.units, id)
+	}
+	s.base.history[id] = append(versions, v)
+	s.base.trim(id, now)
+	s.base.changed(before, u, v)
+}
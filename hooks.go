@@ -0,0 +1,131 @@
+package illygen
+
+import "time"
+
+// Middleware wraps the execution of every node in a run.
+// It receives the node being run and the next NodeFunc in the chain,
+// and returns the NodeFunc to call instead. Returning a Result without
+// calling next short-circuits the node.
+//
+//	timing := func(node *illygen.Node, next illygen.NodeFunc) illygen.NodeFunc {
+//	    return func(ctx illygen.Context) illygen.Result {
+//	        start := time.Now()
+//	        defer func() { log.Printf("%s took %s", node.ID(), time.Since(start)) }()
+//	        return next(ctx)
+//	    }
+//	}
+//	engine := illygen.NewEngine().Use(timing)
+type Middleware func(node *Node, next NodeFunc) NodeFunc
+
+// RunInfo identifies a single run to Hooks.
+// The same *RunInfo is passed to every hook of one run.
+type RunInfo struct {
+	// ID is unique per run within an Engine.
+	ID uint64
+
+	// Flow is the flow being run.
+	Flow *Flow
+
+	// Context is the Context the run's nodes see.
+	Context Context
+
+	// Start is when the run began.
+	Start time.Time
+
+	// Recording is the run's Recording, with Engine.RecordRuns.
+	// It is complete by the time OnRunEnd is called.
+	Recording *Recording
+}
+
+// Hooks observe the lifecycle of every run of an Engine.
+// Any field may be nil. For each run, hooks are called in this order:
+//
+//	OnRunStart
+//	for each node: (Middleware → node) → OnStep → OnRoute (unless the flow ends)
+//	OnError (only if the run failed)
+//	OnRunEnd
+//
+// All hooks of a run are called from the goroutine that called Run.
+// Runs on the same Engine may be concurrent, so hooks that share state
+// across runs must synchronise it themselves.
+type Hooks struct {
+	// OnRunStart is called before the entry node runs.
+	OnRunStart func(run *RunInfo)
+
+	// OnStep is called after each node has run and its route was chosen.
+	OnStep func(run *RunInfo, step Step)
+
+	// OnRoute is called when the engine moves from one node to the next.
+	OnRoute func(run *RunInfo, from, to string, reason RouteReason)
+
+	// OnError is called once if the run fails, before OnRunEnd.
+	OnError func(run *RunInfo, err error)
+
+	// OnRunEnd is called last, whether the run succeeded or not.
+	// trace is nil when err is not.
+	OnRunEnd func(run *RunInfo, trace *Trace, err error)
+}
+
+// Use appends middleware to the engine. The first middleware added is the
+// outermost: it sees each node call first and its Result last.
+// Returns the Engine for chaining.
+func (e *Engine) Use(mw ...Middleware) *Engine {
+	e.middleware = append(e.middleware, mw...)
+	return e
+}
+
+// Hooks registers a set of lifecycle hooks. It may be called more than
+// once; hook sets are called in the order they were registered.
+// Returns the Engine for chaining.
+func (e *Engine) Hooks(h Hooks) *Engine {
+	e.hooks = append(e.hooks, h)
+	return e
+}
+
+// wrap applies the engine's middleware chain to a node.
+func (e *Engine) wrap(node *Node) NodeFunc {
+	fn := node.fn
+	for i := len(e.middleware) - 1; i >= 0; i-- {
+		fn = e.middleware[i](node, fn)
+	}
+	return fn
+}
+
+func (e *Engine) runStart(run *RunInfo) {
+	for _, h := range e.hooks {
+		if h.OnRunStart != nil {
+			h.OnRunStart(run)
+		}
+	}
+}
+
+func (e *Engine) step(run *RunInfo, step Step) {
+	for _, h := range e.hooks {
+		if h.OnStep != nil {
+			h.OnStep(run, step)
+		}
+	}
+	if step.Next == "" {
+		return
+	}
+	for _, h := range e.hooks {
+		if h.OnRoute != nil {
+			h.OnRoute(run, step.NodeID, step.Next, step.Route)
+		}
+	}
+}
+
+func (e *Engine) runEnd(run *RunInfo, trace *Trace, err error) {
+	if err != nil {
+		for _, h := range e.hooks {
+			if h.OnError != nil {
+				h.OnError(run, err)
+			}
+		}
+	}
+	for _, h := range e.hooks {
+		if h.OnRunEnd != nil {
+			h.OnRunEnd(run, trace, err)
+		}
+	}
+}
@@ -42,6 +42,7 @@
 //	flow.Link(from, to, w)    → *Flow
 //	flow.Entry(nodeID)         → *Flow
 //
+//	engine.Routing(strategy)   → *Engine
 //	engine.Run(flow, ctx)      → (Result, error)
 //
 //	ctx.Get(key)               → any
@@ -51,6 +52,12 @@
 //
 //	result.Value               → any
 //	result.Confidence          → float64
+//	result.Next                → string  (empty: the Strategy picks a Link)
+//
+// A node routes by setting Result.Next. When it leaves Next empty, the
+// engine's routing Strategy picks one of its Links: Greedy, the default,
+// follows the highest-weight Link; EpsilonGreedy, Softmax, UCB1 and
+// ThompsonSampling explore the others too.
 //
 // Everything else is internal.
 package illygen
@@ -1,10 +1,17 @@
 package illygen_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	illygen "github.com/leraniode/illygen"
 )
@@ -524,3 +531,2798 @@ func TestKnowledge_NilWhenNoStore(t *testing.T) {
 		t.Errorf("unexpected: %v", result.Value)
 	}
 }
+
+// ─────────────────────────────────────────────
+//  Routing
+// ─────────────────────────────────────────────
+
+// branchFlow builds a → {hi (0.9), lo (0.1)} where each leaf returns its own ID.
+func branchFlow() *illygen.Flow {
+	leaf := func(id string) *illygen.Node {
+		return illygen.NewNode(id, func(ctx illygen.Context) illygen.Result {
+			return illygen.Result{Value: id, Confidence: 1.0}
+		})
+	}
+	a := illygen.NewNode("a", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{Confidence: 1.0}
+	})
+	return illygen.NewFlow().
+		Add(a).Add(leaf("hi")).Add(leaf("lo")).
+		Link("a", "hi", 0.9).
+		Link("a", "lo", 0.1)
+}
+
+func routeCounts(t *testing.T, engine *illygen.Engine, runs int) map[any]int {
+	t.Helper()
+	flow := branchFlow()
+	counts := map[any]int{}
+	for i := 0; i < runs; i++ {
+		res, err := engine.Run(flow, illygen.Context{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[res.Value]++
+	}
+	return counts
+}
+
+func TestRouting_DefaultGreedy(t *testing.T) {
+	counts := routeCounts(t, illygen.NewEngine(), 20)
+	if counts["hi"] != 20 {
+		t.Errorf("expected greedy routing to always pick hi, got %v", counts)
+	}
+}
+
+func TestRouting_SoftmaxExploresLowerWeight(t *testing.T) {
+	engine := illygen.NewEngine().Routing(illygen.Softmax(0.5)).Seed(1)
+	counts := routeCounts(t, engine, 200)
+	if counts["lo"] == 0 {
+		t.Errorf("expected softmax to explore the low-weight link, got %v", counts)
+	}
+	if counts["hi"] <= counts["lo"] {
+		t.Errorf("expected the high-weight link to be preferred, got %v", counts)
+	}
+}
+
+func TestRouting_SeedIsReproducible(t *testing.T) {
+	first := routeCounts(t, illygen.NewEngine().Routing(illygen.Softmax(1.0)).Seed(7), 50)
+	second := routeCounts(t, illygen.NewEngine().Routing(illygen.Softmax(1.0)).Seed(7), 50)
+	if first["hi"] != second["hi"] || first["lo"] != second["lo"] {
+		t.Errorf("expected identical routing for identical seeds, got %v and %v", first, second)
+	}
+}
+
+func TestRouting_EpsilonGreedy(t *testing.T) {
+	if counts := routeCounts(t, illygen.NewEngine().Routing(illygen.EpsilonGreedy(0)), 20); counts["hi"] != 20 {
+		t.Errorf("expected epsilon 0 to behave greedily, got %v", counts)
+	}
+	counts := routeCounts(t, illygen.NewEngine().Routing(illygen.EpsilonGreedy(1)).Seed(3), 200)
+	if counts["lo"] == 0 {
+		t.Errorf("expected epsilon 1 to explore uniformly, got %v", counts)
+	}
+}
+
+func TestRouting_NextOverridesStrategy(t *testing.T) {
+	a := illygen.NewNode("a", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{Next: "lo"}
+	})
+	lo := illygen.NewNode("lo", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{Value: "lo"}
+	})
+	hi := illygen.NewNode("hi", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{Value: "hi"}
+	})
+	flow := illygen.NewFlow().Add(a).Add(lo).Add(hi).Link("a", "hi", 1.0)
+	engine := illygen.NewEngine().Routing(illygen.EpsilonGreedy(1)).Seed(1)
+
+	for i := 0; i < 10; i++ {
+		res, err := engine.Run(flow, illygen.Context{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Value != "lo" {
+			t.Fatalf("expected explicit Next to win over the strategy, got %v", res.Value)
+		}
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Trace & bandit routing
+// ─────────────────────────────────────────────
+
+func TestEngine_RunTrace(t *testing.T) {
+	trace, err := illygen.NewEngine().RunTrace(branchFlow(), illygen.Context{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.Steps) != 2 {
+		t.Fatalf("expected 2 steps, got %d", len(trace.Steps))
+	}
+	if trace.Steps[0].NodeID != "a" || trace.Steps[0].Next != "hi" || trace.Steps[0].Route != illygen.RouteLink {
+		t.Errorf("unexpected first step: %+v", trace.Steps[0])
+	}
+	if trace.Steps[1].Route != illygen.RouteEnd {
+		t.Errorf("expected last step to end the flow, got %q", trace.Steps[1].Route)
+	}
+	if trace.Result.Value != "hi" {
+		t.Errorf("expected trace result %q, got %v", "hi", trace.Result.Value)
+	}
+}
+
+func TestFlow_Feedback_UpdatesEdgeStats(t *testing.T) {
+	flow := branchFlow()
+	trace, err := illygen.NewEngine().RunTrace(flow, illygen.Context{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow.Feedback(trace, 1.0)
+	flow.Feedback(trace, 0.0)
+
+	edges := flow.Edges("a")
+	if edges[0].To != "hi" || edges[0].Pulls != 2 || edges[0].MeanReward != 0.5 {
+		t.Errorf("unexpected stats for a → hi: %+v", edges[0])
+	}
+	if edges[1].Pulls != 0 {
+		t.Errorf("expected untouched stats for a → lo, got %+v", edges[1])
+	}
+}
+
+// banditRounds runs the branch flow repeatedly, rewarding only the "lo" leaf,
+// and returns how often each leaf was chosen over the last half of the rounds.
+func banditRounds(t *testing.T, strategy illygen.Strategy, rounds int) map[any]int {
+	t.Helper()
+	flow := branchFlow()
+	engine := illygen.NewEngine().Routing(strategy).Seed(11)
+	late := map[any]int{}
+	for i := 0; i < rounds; i++ {
+		trace, err := engine.RunTrace(flow, illygen.Context{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reward := 0.0
+		if trace.Result.Value == "lo" {
+			reward = 1.0
+		}
+		flow.Feedback(trace, reward)
+		if i >= rounds/2 {
+			late[trace.Result.Value]++
+		}
+	}
+	return late
+}
+
+func TestRouting_UCB1LearnsFromFeedback(t *testing.T) {
+	late := banditRounds(t, illygen.UCB1(), 200)
+	if late["lo"] <= late["hi"] {
+		t.Errorf("expected UCB1 to favour the rewarded link, got %v", late)
+	}
+}
+
+func TestRouting_ThompsonSamplingLearnsFromFeedback(t *testing.T) {
+	late := banditRounds(t, illygen.ThompsonSampling(), 200)
+	if late["lo"] <= late["hi"] {
+		t.Errorf("expected Thompson sampling to favour the rewarded link, got %v", late)
+	}
+}
+
+func TestFlow_SaveAndLoadStats(t *testing.T) {
+	flow := branchFlow()
+	trace, _ := illygen.NewEngine().RunTrace(flow, illygen.Context{})
+	flow.Feedback(trace, 0.75)
+
+	var buf strings.Builder
+	if err := flow.SaveStats(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := branchFlow()
+	if err := restored.LoadStats(strings.NewReader(buf.String())); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.Edges("a")[0]; got.Pulls != 1 || got.MeanReward != 0.75 {
+		t.Errorf("expected restored stats, got %+v", got)
+	}
+
+	empty := illygen.NewFlow()
+	if err := empty.LoadStats(strings.NewReader(buf.String())); err == nil {
+		t.Error("expected error loading stats for links the flow does not have")
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Beam search
+// ─────────────────────────────────────────────
+
+// trapFlow looks good greedily (a → bait at 0.9) but bait leads to a
+// low-confidence answer, while the weaker link a → good ends confidently.
+func trapFlow() *illygen.Flow {
+	a := illygen.NewNode("a", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{Confidence: 1.0}
+	})
+	bait := illygen.NewNode("bait", func(ctx illygen.Context) illygen.Result {
+		ctx.Set("visited", "bait")
+		return illygen.Result{Confidence: 1.0}
+	})
+	poor := illygen.NewNode("poor", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{Value: "poor:" + ctx.String("visited"), Confidence: 0.1}
+	})
+	good := illygen.NewNode("good", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{Value: "good:" + ctx.String("visited"), Confidence: 1.0}
+	})
+	return illygen.NewFlow().
+		Add(a).Add(bait).Add(poor).Add(good).
+		Link("a", "bait", 0.9).
+		Link("a", "good", 0.8).
+		Link("bait", "poor", 1.0)
+}
+
+func TestEngine_Beam_AvoidsGreedyTrap(t *testing.T) {
+	engine := illygen.NewEngine()
+
+	greedy, err := engine.Run(trapFlow(), illygen.Context{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if greedy.Value != "poor:bait" {
+		t.Fatalf("expected greedy routing to fall into the trap, got %v", greedy.Value)
+	}
+
+	res, err := engine.Beam(trapFlow(), illygen.Context{}, illygen.BeamOptions{Width: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each branch has its own Context, so "good" must not see bait's write.
+	if res.Best.Trace.Result.Value != "good:" {
+		t.Errorf("expected beam search to find the good path, got %v", res.Best.Trace.Result.Value)
+	}
+	if len(res.Alternatives) != 1 || res.Alternatives[0].Trace.Result.Value != "poor:bait" {
+		t.Errorf("expected the trap as the runner-up, got %+v", res.Alternatives)
+	}
+	if res.Best.Score <= res.Alternatives[0].Score {
+		t.Errorf("expected best score above runner-up, got %f vs %f", res.Best.Score, res.Alternatives[0].Score)
+	}
+}
+
+func TestEngine_Beam_StepBudget(t *testing.T) {
+	loop := illygen.NewNode("loop", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{Next: "loop", Confidence: 1.0}
+	})
+	flow := illygen.NewFlow().Add(loop)
+
+	_, err := illygen.NewEngine().Beam(flow, illygen.Context{}, illygen.BeamOptions{MaxSteps: 10})
+	var steps *illygen.StepLimitError
+	if !errors.As(err, &steps) || steps.Steps != 10 {
+		t.Errorf("expected *StepLimitError when no path completes within the step budget, got %v", err)
+	}
+}
+
+func TestEngine_Beam_AppliesLimits(t *testing.T) {
+	loop := illygen.NewNode("loop", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{Next: "loop", Confidence: 1.0}
+	})
+	flow := illygen.NewFlow().Add(loop)
+
+	engine := illygen.NewEngine().Limits(illygen.Limits{MaxSteps: 5})
+	_, err := engine.Beam(flow, illygen.Context{}, illygen.BeamOptions{})
+	var steps *illygen.StepLimitError
+	if !errors.As(err, &steps) || steps.Steps != 5 {
+		t.Errorf("expected *StepLimitError at the engine's 5 steps, got %v", err)
+	}
+
+	engine = illygen.NewEngine().Limits(illygen.Limits{MaxVisits: 3})
+	_, err = engine.Beam(flow, illygen.Context{}, illygen.BeamOptions{})
+	var cycle *illygen.CycleError
+	if !errors.As(err, &cycle) || cycle.NodeID != "loop" {
+		t.Errorf("expected *CycleError on node loop, got %v", err)
+	}
+
+	stuck := illygen.NewNode("stuck", func(ctx illygen.Context) illygen.Result {
+		<-illygen.Done(ctx)
+		ctx.Set("late", true)
+		return illygen.Result{}
+	})
+	engine = illygen.NewEngine().Limits(illygen.Limits{NodeTimeout: 10 * time.Millisecond})
+	_, err = engine.Beam(illygen.NewFlow().Add(stuck), illygen.Context{}, illygen.BeamOptions{})
+	var timeout *illygen.NodeTimeoutError
+	if !errors.As(err, &timeout) {
+		t.Errorf("expected *NodeTimeoutError, got %v", err)
+	}
+}
+
+func TestEngine_Beam_UnlinkedNextScoresByConfidence(t *testing.T) {
+	leaf := func(id string) *illygen.Node {
+		return illygen.NewNode(id, func(ctx illygen.Context) illygen.Result {
+			return illygen.Result{Value: id, Confidence: 1.0}
+		})
+	}
+	// p jumps to x without a Link, unsure of the choice; q is an ordinary leaf.
+	p := illygen.NewNode("p", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{Next: "x", Confidence: 0.5}
+	})
+	flow := illygen.NewFlow().
+		Add(leaf("start")).Add(p).Add(leaf("q")).Add(leaf("x")).
+		Link("start", "p", 0.6).
+		Link("start", "q", 0.4)
+
+	res, err := illygen.NewEngine().Beam(flow, illygen.Context{}, illygen.BeamOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Best.Trace.Result.Value != "q" {
+		t.Errorf("expected the linked path to q to win, got %v", res.Best.Trace.Result.Value)
+	}
+	// 0.6 (start → p) × 0.5 (p's confidence in x) × mean confidence 2.5/3.
+	if len(res.Alternatives) != 1 || math.Abs(res.Alternatives[0].Score-0.25) > 1e-9 {
+		t.Errorf("expected the jump to x to score 0.25, got %+v", res.Alternatives)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Limits
+// ─────────────────────────────────────────────
+
+// countingLoop routes back to itself until it has run n times.
+func countingLoop(n int) *illygen.Flow {
+	loop := illygen.NewNode("loop", func(ctx illygen.Context) illygen.Result {
+		ctx.Set("n", ctx.Int("n")+1)
+		if ctx.Int("n") < n {
+			return illygen.Result{Next: "loop"}
+		}
+		return illygen.Result{Value: ctx.Int("n"), Confidence: 1.0}
+	})
+	return illygen.NewFlow().Add(loop)
+}
+
+func TestLimits_DefaultCycleGuard(t *testing.T) {
+	_, err := illygen.NewEngine().Run(countingLoop(1000), illygen.Context{})
+	var cycle *illygen.CycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("expected *CycleError, got %v", err)
+	}
+	if cycle.NodeID != "loop" || cycle.Visits != 51 {
+		t.Errorf("unexpected cycle error: %+v", cycle)
+	}
+}
+
+func TestLimits_MaxVisits(t *testing.T) {
+	engine := illygen.NewEngine().Limits(illygen.Limits{MaxVisits: 100})
+	res, err := engine.Run(countingLoop(80), illygen.Context{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != 80 {
+		t.Errorf("expected 80 iterations, got %v", res.Value)
+	}
+}
+
+func TestLimits_AllowCyclesWithMaxSteps(t *testing.T) {
+	engine := illygen.NewEngine().Limits(illygen.Limits{AllowCycles: true, MaxSteps: 500})
+
+	if _, err := engine.Run(countingLoop(300), illygen.Context{}); err != nil {
+		t.Fatalf("expected intentional loop to finish, got %v", err)
+	}
+
+	_, err := engine.Run(countingLoop(1000), illygen.Context{})
+	var steps *illygen.StepLimitError
+	if !errors.As(err, &steps) {
+		t.Fatalf("expected *StepLimitError, got %v", err)
+	}
+	if steps.Steps != 500 {
+		t.Errorf("expected limit of 500 steps, got %d", steps.Steps)
+	}
+}
+
+func TestLimits_Timeout(t *testing.T) {
+	slow := illygen.NewNode("slow", func(ctx illygen.Context) illygen.Result {
+		time.Sleep(5 * time.Millisecond)
+		return illygen.Result{Next: "slow"}
+	})
+	flow := illygen.NewFlow().Add(slow)
+	engine := illygen.NewEngine().Limits(illygen.Limits{AllowCycles: true, Timeout: 20 * time.Millisecond})
+
+	_, err := engine.Run(flow, illygen.Context{})
+	var timeout *illygen.TimeoutError
+	if !errors.As(err, &timeout) {
+		t.Fatalf("expected *TimeoutError, got %v", err)
+	}
+}
+
+func TestLimits_NodeTimeout(t *testing.T) {
+	stuck := illygen.NewNode("stuck", func(ctx illygen.Context) illygen.Result {
+		time.Sleep(200 * time.Millisecond)
+		return illygen.Result{Value: "late"}
+	})
+	flow := illygen.NewFlow().Add(stuck)
+	engine := illygen.NewEngine().Limits(illygen.Limits{NodeTimeout: 10 * time.Millisecond})
+
+	_, err := engine.Run(flow, illygen.Context{})
+	var timeout *illygen.NodeTimeoutError
+	if !errors.As(err, &timeout) {
+		t.Fatalf("expected *NodeTimeoutError, got %v", err)
+	}
+	if timeout.NodeID != "stuck" {
+		t.Errorf("expected timeout on node %q, got %q", "stuck", timeout.NodeID)
+	}
+}
+
+func TestLimits_NodeTimeoutPanic(t *testing.T) {
+	boom := illygen.NewNode("boom", func(ctx illygen.Context) illygen.Result {
+		panic("boom")
+	})
+	flow := illygen.NewFlow().Add(boom)
+	engine := illygen.NewEngine().Limits(illygen.Limits{NodeTimeout: time.Second})
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("expected the node's panic on the caller's goroutine, got %v", r)
+		}
+	}()
+	_, _ = engine.Run(flow, illygen.Context{})
+	t.Error("expected Run to panic")
+}
+
+func TestLimits_TimedOutNodeCannotWriteContext(t *testing.T) {
+	finished := make(chan struct{})
+	stuck := illygen.NewNode("stuck", func(ctx illygen.Context) illygen.Result {
+		<-illygen.Done(ctx)
+		ctx.Set("late", true)
+		close(finished)
+		return illygen.Result{}
+	})
+	flow := illygen.NewFlow().Add(stuck)
+	engine := illygen.NewEngine().Limits(illygen.Limits{NodeTimeout: 10 * time.Millisecond})
+
+	ctx := illygen.Context{"input": "x"}
+	_, err := engine.Run(flow, ctx)
+	var timeout *illygen.NodeTimeoutError
+	if !errors.As(err, &timeout) {
+		t.Fatalf("expected *NodeTimeoutError, got %v", err)
+	}
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("Done(ctx) was not closed when the node timed out")
+	}
+	if _, ok := ctx["late"]; ok {
+		t.Error("a timed-out node wrote to the caller's Context")
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Middleware & hooks
+// ─────────────────────────────────────────────
+
+func TestEngine_Use_MiddlewareOrder(t *testing.T) {
+	var calls []string
+	tag := func(name string) illygen.Middleware {
+		return func(node *illygen.Node, next illygen.NodeFunc) illygen.NodeFunc {
+			return func(ctx illygen.Context) illygen.Result {
+				calls = append(calls, name+">"+node.ID())
+				res := next(ctx)
+				calls = append(calls, name+"<"+node.ID())
+				return res
+			}
+		}
+	}
+
+	engine := illygen.NewEngine().Use(tag("outer"), tag("inner"))
+	if _, err := engine.Run(branchFlow(), illygen.Context{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "outer>a inner>a inner<a outer<a outer>hi inner>hi inner<hi outer<hi"
+	if got := strings.Join(calls, " "); got != want {
+		t.Errorf("expected middleware order\n  %s\ngot\n  %s", want, got)
+	}
+}
+
+func TestEngine_Use_ShortCircuit(t *testing.T) {
+	block := func(node *illygen.Node, next illygen.NodeFunc) illygen.NodeFunc {
+		if node.ID() != "a" {
+			return next
+		}
+		return func(ctx illygen.Context) illygen.Result {
+			return illygen.Result{Value: "blocked", Confidence: 1.0}
+		}
+	}
+	engine := illygen.NewEngine().Use(block)
+
+	// The short-circuited node sets no Next, so the graph link is still followed.
+	res, err := engine.RunTrace(branchFlow(), illygen.Context{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Steps[0].Value != "blocked" {
+		t.Errorf("expected middleware to replace node a's result, got %v", res.Steps[0].Value)
+	}
+}
+
+func TestEngine_Hooks_Order(t *testing.T) {
+	var events []string
+	engine := illygen.NewEngine().Hooks(illygen.Hooks{
+		OnRunStart: func(run *illygen.RunInfo) { events = append(events, "start") },
+		OnStep: func(run *illygen.RunInfo, step illygen.Step) {
+			events = append(events, "step:"+step.NodeID)
+		},
+		OnRoute: func(run *illygen.RunInfo, from, to string, reason illygen.RouteReason) {
+			events = append(events, fmt.Sprintf("route:%s→%s(%s)", from, to, reason))
+		},
+		OnError:  func(run *illygen.RunInfo, err error) { events = append(events, "error") },
+		OnRunEnd: func(run *illygen.RunInfo, trace *illygen.Trace, err error) { events = append(events, "end") },
+	})
+
+	if _, err := engine.Run(branchFlow(), illygen.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	want := "start step:a route:a→hi(link) step:hi end"
+	if got := strings.Join(events, " "); got != want {
+		t.Errorf("expected hook order\n  %s\ngot\n  %s", want, got)
+	}
+
+	events = nil
+	if _, err := engine.Run(countingLoop(1000), illygen.Context{}); err == nil {
+		t.Fatal("expected cycle error")
+	}
+	if got := events[len(events)-2:]; got[0] != "error" || got[1] != "end" {
+		t.Errorf("expected OnError then OnRunEnd on failure, got %v", got)
+	}
+}
+
+func TestEngine_Hooks_ConcurrentRunsGetDistinctInfo(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[uint64]bool{}
+	engine := illygen.NewEngine().Hooks(illygen.Hooks{
+		OnRunEnd: func(run *illygen.RunInfo, trace *illygen.Trace, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			seen[run.ID] = true
+		},
+	})
+	flow := branchFlow()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = engine.Run(flow, illygen.Context{})
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != 20 {
+		t.Errorf("expected 20 distinct run IDs, got %d", len(seen))
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Logging
+// ─────────────────────────────────────────────
+
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestEngine_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	engine := illygen.NewEngine().Logger(logger, illygen.LogOptions{
+		Redact: illygen.RedactKeys("token"),
+	})
+
+	if _, err := engine.Run(branchFlow(), illygen.Context{"token": "s3cret", "user": "ada"}); err != nil {
+		t.Fatal(err)
+	}
+
+	records := logRecords(t, &buf)
+	if len(records) != 4 {
+		t.Fatalf("expected start, 2 steps and end records, got %d: %s", len(records), buf.String())
+	}
+	if strings.Contains(buf.String(), "s3cret") {
+		t.Error("expected redacted context value to be absent from logs")
+	}
+	ctx := records[0]["context"].(map[string]any)
+	if ctx["token"] != "[REDACTED]" || ctx["user"] != "ada" {
+		t.Errorf("unexpected logged context: %v", ctx)
+	}
+	step := records[1]
+	if step["node"] != "a" || step["next"] != "hi" || step["route"] != "link" {
+		t.Errorf("unexpected step record: %v", step)
+	}
+	if records[3]["msg"] != "illygen: run finished" {
+		t.Errorf("expected final run record, got %v", records[3]["msg"])
+	}
+}
+
+func TestEngine_Logger_LevelAndErrors(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	engine := illygen.NewEngine().Logger(logger, illygen.LogOptions{Level: slog.LevelDebug})
+
+	if _, err := engine.Run(countingLoop(1000), illygen.Context{}); err == nil {
+		t.Fatal("expected cycle error")
+	}
+
+	// Debug run and step records are filtered out; the failure is not.
+	records := logRecords(t, &buf)
+	if len(records) != 1 || records[0]["level"] != "ERROR" {
+		t.Fatalf("expected a single error record, got %s", buf.String())
+	}
+	if !strings.Contains(records[0]["error"].(string), "cycle") {
+		t.Errorf("expected error attribute to describe the cycle, got %v", records[0]["error"])
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Metrics
+// ─────────────────────────────────────────────
+
+func TestEngine_Metrics(t *testing.T) {
+	metrics := illygen.NewMemoryMetrics()
+	engine := illygen.NewEngine().Metrics(metrics)
+	flow := branchFlow().Named("branch")
+
+	for i := 0; i < 3; i++ {
+		if _, err := engine.Run(flow, illygen.Context{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := engine.Run(countingLoop(1000).Named("loop"), illygen.Context{}); err == nil {
+		t.Fatal("expected cycle error")
+	}
+
+	if f := metrics.Flow("branch"); f.Runs != 3 || f.Errors != 0 || f.Latency.Count != 3 {
+		t.Errorf("unexpected flow stats: %+v", f)
+	}
+	if f := metrics.Flow("loop"); f.ErrorRate() != 1 {
+		t.Errorf("expected error rate 1 for failing flow, got %f", f.ErrorRate())
+	}
+
+	a := metrics.Node("branch", "a")
+	if a.Visits != 3 || a.FallbackRate() != 1 {
+		t.Errorf("expected 3 visits all routed by the graph, got %+v", a)
+	}
+	if a.Confidence.Mean() != 1.0 || a.Latency.Count != 3 {
+		t.Errorf("unexpected histograms for node a: %+v", a)
+	}
+	if hi := metrics.Node("branch", "hi"); hi.Visits != 3 || hi.Fallbacks != 0 {
+		t.Errorf("unexpected stats for terminal node: %+v", hi)
+	}
+	if loop := metrics.Node("loop", "loop"); loop.Errors != 1 || loop.Visits != 50 {
+		t.Errorf("expected the cycle to count as an error at node loop, got %+v", loop)
+	}
+}
+
+func TestEngine_Metrics_NodeErrors(t *testing.T) {
+	metrics := illygen.NewMemoryMetrics()
+	engine := illygen.NewEngine().Metrics(metrics)
+	flow := illygen.NewFlow().
+		Add(illygen.NewNode("start", func(ctx illygen.Context) illygen.Result {
+			return illygen.Result{Next: "lost"}
+		})).
+		Named("broken")
+
+	_, err := engine.Run(flow, illygen.Context{})
+	var route *illygen.RouteError
+	if !errors.As(err, &route) || route.NodeID != "start" || route.Next != "lost" {
+		t.Fatalf("expected *RouteError from start to lost, got %v", err)
+	}
+	if _, err := engine.Run(branchFlow().Named("broken"), illygen.Context{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := metrics.Node("broken", "start"); s.Errors != 1 || s.Visits != 0 || s.ErrorRate() != 1 {
+		t.Errorf("expected one failed execution of start, got %+v", s)
+	}
+	if a := metrics.Node("broken", "a"); a.Errors != 0 || a.ErrorRate() != 0 {
+		t.Errorf("expected no errors for node a, got %+v", a)
+	}
+
+	var buf bytes.Buffer
+	if err := metrics.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := `illygen_node_errors_total{flow="broken",node="start"} 1`; !strings.Contains(buf.String(), want) {
+		t.Errorf("expected exposition to contain %q\n%s", want, buf.String())
+	}
+}
+
+func TestMemoryMetrics_WritePrometheus(t *testing.T) {
+	metrics := illygen.NewMemoryMetrics()
+	engine := illygen.NewEngine().Metrics(metrics)
+	if _, err := engine.Run(branchFlow().Named(`say "hi"`), illygen.Context{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := metrics.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE illygen_runs_total counter",
+		`illygen_runs_total{flow="say \"hi\""} 1`,
+		`illygen_node_visits_total{flow="say \"hi\"",node="a"} 1`,
+		`illygen_node_fallbacks_total{flow="say \"hi\"",node="a"} 1`,
+		`illygen_node_confidence_bucket{flow="say \"hi\"",node="hi",le="1"} 1`,
+		`illygen_node_duration_seconds_count{flow="say \"hi\"",node="hi"} 1`,
+		"# TYPE illygen_run_duration_seconds histogram",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected exposition to contain %q\n%s", want, out)
+		}
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Tracing
+// ─────────────────────────────────────────────
+
+func TestEngine_Tracer(t *testing.T) {
+	recorder := illygen.NewSpanRecorder()
+	engine := illygen.NewEngine().Tracer(recorder)
+	if _, err := engine.Run(branchFlow().Named("branch"), illygen.Context{}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 2 node spans and 1 run span, got %d", len(spans))
+	}
+	root := spans[2]
+	if root.Name != "illygen.run" || root.ParentID != "" || root.Attributes["illygen.flow"] != "branch" {
+		t.Errorf("unexpected root span: %+v", root)
+	}
+	for _, s := range spans[:2] {
+		if s.Name != "illygen.node" || s.TraceID != root.TraceID || s.ParentID != root.SpanID {
+			t.Errorf("expected node span to be a child of the run span, got %+v", s)
+		}
+		if s.Start.Before(root.Start) || s.End.After(root.End) {
+			t.Errorf("expected node span within the run span, got %+v", s)
+		}
+	}
+	if spans[0].Attributes["illygen.node"] != "a" || spans[0].Attributes["illygen.route"] != "link" {
+		t.Errorf("unexpected attributes on first node span: %v", spans[0].Attributes)
+	}
+}
+
+func TestSpanRecorder_WriteJSON(t *testing.T) {
+	recorder := illygen.NewSpanRecorder()
+	engine := illygen.NewEngine().Tracer(recorder)
+	if _, err := engine.Run(countingLoop(1000), illygen.Context{}); err == nil {
+		t.Fatal("expected cycle error")
+	}
+
+	var buf bytes.Buffer
+	if err := recorder.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID           string `json:"traceId"`
+					SpanID            string `json:"spanId"`
+					Name              string `json:"name"`
+					StartTimeUnixNano string `json:"startTimeUnixNano"`
+					Status            struct {
+						Code    int    `json:"code"`
+						Message string `json:"message"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	spans := doc.ResourceSpans[0].ScopeSpans[0].Spans
+	root := spans[len(spans)-1]
+	if root.Name != "illygen.run" || root.Status.Code != 2 || !strings.Contains(root.Status.Message, "cycle") {
+		t.Errorf("expected failed run span with error status, got %+v", root)
+	}
+	if len(root.TraceID) != 32 || len(root.SpanID) != 16 || root.StartTimeUnixNano == "" {
+		t.Errorf("expected OTLP-style IDs and timestamps, got %+v", root)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Context isolation
+// ─────────────────────────────────────────────
+
+func TestEngine_Isolate(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	_ = store.Add("k1", "facts", map[string]any{"answer": "42"})
+
+	node := illygen.NewNode("writer", func(ctx illygen.Context) illygen.Result {
+		ctx.Set("seen", ctx.String("input"))
+		return illygen.Result{Value: illygen.Knowledge(ctx).Domain("facts")[0].Fact("answer")}
+	})
+	flow := illygen.NewFlow().Add(node)
+	engine := illygen.NewEngine(store).Isolate(true)
+
+	input := illygen.Context{"input": "hello"}
+	trace, err := engine.RunTrace(flow, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace.Result.Value != "42" {
+		t.Errorf("expected knowledge to be reachable in isolated runs, got %v", trace.Result.Value)
+	}
+	if len(input) != 1 || input.Has("seen") {
+		t.Errorf("expected caller context to be untouched, got %v", input)
+	}
+	if trace.Context.String("seen") != "hello" {
+		t.Errorf("expected final context to hold node writes, got %v", trace.Context)
+	}
+	for k := range trace.Context {
+		if strings.HasPrefix(k, "__") {
+			t.Errorf("expected no internal keys in final context, found %q", k)
+		}
+	}
+}
+
+func TestEngine_Isolate_SharedContextAcrossGoroutines(t *testing.T) {
+	node := illygen.NewNode("counter", func(ctx illygen.Context) illygen.Result {
+		ctx.Set("n", ctx.Int("n")+1)
+		return illygen.Result{Value: ctx.Int("n")}
+	})
+	flow := illygen.NewFlow().Add(node)
+	engine := illygen.NewEngine(illygen.NewKnowledgeStore()).Isolate(true)
+	shared := illygen.Context{"n": 0}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := engine.Run(flow, shared)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if res.Value != 1 {
+				t.Errorf("expected each run to start from the shared input, got %v", res.Value)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestEngine_Isolate_NestedValues(t *testing.T) {
+	node := illygen.NewNode("mutator", func(ctx illygen.Context) illygen.Result {
+		user := ctx.Get("user").(map[string]any)
+		user["name"] = "grace"
+		user["tags"].([]string)[0] = "changed"
+		ctx.Get("history").([]any)[0].(map[string]any)["seen"] = true
+		return illygen.Result{}
+	})
+	flow := illygen.NewFlow().Add(node)
+
+	tags := []string{"admin"}
+	input := illygen.Context{
+		"user":    map[string]any{"name": "ada", "tags": tags},
+		"history": []any{map[string]any{"seen": false}},
+	}
+	self := map[string]any{}
+	self["self"] = self
+	input["cycle"] = self
+
+	trace, err := illygen.NewEngine().Isolate(true).RunTrace(flow, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := input["user"].(map[string]any)["name"]; name != "ada" {
+		t.Errorf("expected the caller's nested map untouched, got name %v", name)
+	}
+	if tags[0] != "admin" {
+		t.Errorf("expected the caller's nested slice untouched, got %v", tags)
+	}
+	if seen := input["history"].([]any)[0].(map[string]any)["seen"]; seen != false {
+		t.Errorf("expected the caller's map inside a slice untouched, got %v", seen)
+	}
+	if name := trace.Context["user"].(map[string]any)["name"]; name != "grace" {
+		t.Errorf("expected the run's copy to hold the write, got %v", name)
+	}
+	copied := trace.Context["cycle"].(map[string]any)
+	if fmt.Sprintf("%p", copied["self"]) != fmt.Sprintf("%p", copied) || fmt.Sprintf("%p", copied) == fmt.Sprintf("%p", self) {
+		t.Error("expected a self-referencing map to be copied once, keeping its cycle")
+	}
+}
+
+func TestEngine_RunStripsInternalKeys(t *testing.T) {
+	node := illygen.NewNode("writer", func(ctx illygen.Context) illygen.Result {
+		illygen.FlowMemory(ctx).Set("visits", 1)
+		ctx.Set("seen", true)
+		return illygen.Result{Value: "done"}
+	})
+	engine := illygen.NewEngine(illygen.NewKnowledgeStore())
+	input := illygen.Context{"input": "hello"}
+
+	for run := 0; run < 2; run++ {
+		if _, err := engine.Run(illygen.NewFlow().Add(node), input); err != nil {
+			t.Fatal(err)
+		}
+		for k := range input {
+			if strings.HasPrefix(k, "__") {
+				t.Errorf("run %d: expected no internal keys in the caller's context, found %q", run, k)
+			}
+		}
+	}
+	if !input.Has("seen") {
+		t.Error("expected node writes to reach the caller's context without Isolate")
+	}
+
+	// Failed runs clean up too.
+	loop := illygen.NewFlow().
+		Add(illygen.NewNode("a", func(ctx illygen.Context) illygen.Result { return illygen.Result{Next: "a"} }))
+	failed := illygen.Context{}
+	if _, err := engine.Run(loop, failed); err == nil {
+		t.Fatal("expected the cycle to fail")
+	}
+	if len(failed) != 0 {
+		t.Errorf("expected no internal keys after a failed run, got %v", failed)
+	}
+}
+
+func TestEngine_Beam_LeavesCallerContextUntouched(t *testing.T) {
+	input := illygen.Context{}
+	res, err := illygen.NewEngine(illygen.NewKnowledgeStore()).Beam(trapFlow(), input, illygen.BeamOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(input) != 0 {
+		t.Errorf("expected beam search not to write to the caller context, got %v", input)
+	}
+	if res.Alternatives[0].Trace.Context.String("visited") != "bait" {
+		t.Errorf("expected the runner-up's final context, got %v", res.Alternatives[0].Trace.Context)
+	}
+}
+
+func TestEngine_Beam_IsolatesNestedValues(t *testing.T) {
+	// Each branch tags the same nested map: the tag must stay on its path.
+	tag := func(id string) *illygen.Node {
+		return illygen.NewNode(id, func(ctx illygen.Context) illygen.Result {
+			ctx["profile"].(map[string]any)["branch"] = id
+			return illygen.Result{Value: id, Confidence: 1}
+		})
+	}
+	flow := illygen.NewFlow().
+		Add(illygen.NewNode("start", func(ctx illygen.Context) illygen.Result {
+			return illygen.Result{Confidence: 1}
+		})).
+		Add(tag("a")).
+		Add(tag("b")).
+		Link("start", "a", 0.9).
+		Link("start", "b", 0.5)
+
+	profile := map[string]any{"name": "ada"}
+	res, err := illygen.NewEngine().Beam(flow, illygen.Context{"profile": profile}, illygen.BeamOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := profile["branch"]; ok {
+		t.Errorf("expected the caller's nested map to be untouched, got %v", profile)
+	}
+	for _, c := range append([]illygen.Candidate{res.Best}, res.Alternatives...) {
+		got := c.Trace.Context["profile"].(map[string]any)["branch"]
+		if got != c.Trace.Result.Value {
+			t.Errorf("expected path %v to see only its own tag, got %v", c.Trace.Result.Value, got)
+		}
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Scoped memory
+// ─────────────────────────────────────────────
+
+func TestNodeMemory_PersistsAcrossVisitsWithinRun(t *testing.T) {
+	// "retry" loops back to itself, counting its own visits in NodeMemory.
+	retry := illygen.NewNode("retry", func(ctx illygen.Context) illygen.Result {
+		n := illygen.NodeMemory(ctx).Update("attempts", func(old any) any {
+			v, _ := old.(int)
+			return v + 1
+		}).(int)
+		if n < 3 {
+			return illygen.Result{Next: "retry"}
+		}
+		return illygen.Result{Next: "other", Value: n}
+	})
+	other := illygen.NewNode("other", func(ctx illygen.Context) illygen.Result {
+		// A different node must not see retry's memory.
+		return illygen.Result{Value: illygen.NodeMemory(ctx).Has("attempts")}
+	})
+	flow := illygen.NewFlow().Add(retry).Add(other)
+	engine := illygen.NewEngine()
+
+	for i := 0; i < 2; i++ {
+		trace, err := engine.RunTrace(flow, illygen.Context{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(trace.Steps) != 4 {
+			t.Errorf("run %d: expected retry to run 3 times then stop, got %d steps", i, len(trace.Steps))
+		}
+		if trace.Result.Value != false {
+			t.Errorf("run %d: expected node memory to be private to its node", i)
+		}
+	}
+}
+
+func TestFlowMemory_SharedWithinRunOnly(t *testing.T) {
+	a := illygen.NewNode("a", func(ctx illygen.Context) illygen.Result {
+		if illygen.FlowMemory(ctx).Has("note") {
+			return illygen.Result{Value: "leaked from a previous run"}
+		}
+		illygen.FlowMemory(ctx).Set("note", "from a")
+		return illygen.Result{Next: "b"}
+	})
+	b := illygen.NewNode("b", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{Value: illygen.FlowMemory(ctx).Get("note")}
+	})
+	flow := illygen.NewFlow().Add(a).Add(b)
+	engine := illygen.NewEngine()
+
+	for i := 0; i < 2; i++ {
+		trace, err := engine.RunTrace(flow, illygen.Context{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trace.Result.Value != "from a" {
+			t.Errorf("run %d: expected flow memory shared between nodes, got %v", i, trace.Result.Value)
+		}
+		if trace.Context.Has("note") {
+			t.Error("expected flow memory to stay out of the Context")
+		}
+	}
+}
+
+func TestSessionMemory_PersistsAcrossRuns(t *testing.T) {
+	counter := illygen.NewNode("counter", func(ctx illygen.Context) illygen.Result {
+		mem := illygen.SessionMemory(ctx)
+		if mem == nil {
+			return illygen.Result{Value: "no session"}
+		}
+		return illygen.Result{Value: mem.Update("runs", func(old any) any {
+			n, _ := old.(int)
+			return n + 1
+		})}
+	})
+	flow := illygen.NewFlow().Add(counter)
+	engine := illygen.NewEngine()
+
+	for want := 1; want <= 3; want++ {
+		res, err := engine.Session("ada").Run(flow, illygen.Context{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Value != want {
+			t.Errorf("expected run %d of session ada to see %d, got %v", want, want, res.Value)
+		}
+	}
+
+	if res, _ := engine.Session("grace").Run(flow, illygen.Context{}); res.Value != 1 {
+		t.Errorf("expected a separate session to start afresh, got %v", res.Value)
+	}
+	if res, _ := engine.Run(flow, illygen.Context{}); res.Value != "no session" {
+		t.Errorf("expected nil session memory outside a session, got %v", res.Value)
+	}
+	if engine.Session("ada").Memory().Get("runs") != 3 {
+		t.Error("expected session memory to be inspectable from the caller")
+	}
+
+	engine.EndSession("ada")
+	if res, _ := engine.Session("ada").Run(flow, illygen.Context{}); res.Value != 1 {
+		t.Errorf("expected an ended session to start afresh, got %v", res.Value)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Typed keys
+// ─────────────────────────────────────────────
+
+func TestKey_GetSet(t *testing.T) {
+	intent := illygen.NewKey[string]("intent")
+	ctx := illygen.Context{}
+
+	if _, ok := intent.Get(ctx); ok {
+		t.Error("expected ok=false for missing key")
+	}
+	intent.Set(ctx, "greeting")
+	if got, ok := intent.Get(ctx); !ok || got != "greeting" {
+		t.Errorf("expected greeting, got %q (ok=%v)", got, ok)
+	}
+	if ctx.String("intent") != "greeting" {
+		t.Error("expected typed key to write the plain Context key")
+	}
+
+	ctx.Set("intent", 42)
+	if _, ok := intent.Get(ctx); ok {
+		t.Error("expected ok=false for a value of another type")
+	}
+}
+
+func TestKey_NumericConversion(t *testing.T) {
+	count := illygen.NewKey[int]("count")
+	score := illygen.NewKey[float64]("score")
+	small := illygen.NewKey[int8]("small")
+
+	ctx := illygen.Context{"count": int64(7), "score": float32(0.5), "small": 300}
+	if got, ok := count.Get(ctx); !ok || got != 7 {
+		t.Errorf("expected int64 to convert to int, got %d (ok=%v)", got, ok)
+	}
+	if got, ok := score.Get(ctx); !ok || got != 0.5 {
+		t.Errorf("expected float32 to convert to float64, got %f (ok=%v)", got, ok)
+	}
+	if _, ok := small.Get(ctx); ok {
+		t.Error("expected an overflowing conversion to fail")
+	}
+
+	ctx.Set("count", 2.5)
+	if _, ok := count.Get(ctx); ok {
+		t.Error("expected a fractional float not to convert to int")
+	}
+
+	// Conversions to float must round-trip too.
+	ctx.Set("score", int64(1<<53+1))
+	if got, ok := score.Get(ctx); ok {
+		t.Errorf("expected an int64 above 2^53 not to convert to float64, got %f", got)
+	}
+	ctx.Set("score", int64(1<<53))
+	if got, ok := score.Get(ctx); !ok || got != 1<<53 {
+		t.Errorf("expected 2^53 to convert exactly, got %f (ok=%v)", got, ok)
+	}
+	ctx.Set("ratio", 0.1)
+	if _, ok := illygen.NewKey[float32]("ratio").Get(ctx); ok {
+		t.Error("expected a float64 that float32 cannot hold exactly not to convert")
+	}
+}
+
+func TestKey_NilValue(t *testing.T) {
+	ctx := illygen.Context{"err": nil}
+	if v, ok := illygen.NewKey[any]("err").Get(ctx); !ok || v != nil {
+		t.Errorf("expected a stored nil to be found through Key[any], got %v (ok=%v)", v, ok)
+	}
+	if v, ok := illygen.NewKey[error]("err").Get(ctx); !ok || v != nil {
+		t.Errorf("expected a stored nil to be found through Key[error], got %v (ok=%v)", v, ok)
+	}
+	if _, ok := illygen.NewKey[any]("missing").Get(ctx); ok {
+		t.Error("expected a missing key not to be found")
+	}
+	if _, ok := illygen.NewKey[string]("err").Get(ctx); ok {
+		t.Error("expected nil not to be found through Key[string]")
+	}
+}
+
+func TestKey_MustGet(t *testing.T) {
+	user := illygen.NewKey[string]("user")
+	if got := user.MustGet(illygen.Context{"user": "ada"}); got != "ada" {
+		t.Errorf("expected ada, got %q", got)
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(fmt.Sprint(r), "holds int, not string") {
+			t.Errorf("expected descriptive panic for type mismatch, got %v", r)
+		}
+	}()
+	user.MustGet(illygen.Context{"user": 1})
+}
+
+func TestContext_LenientNumbers(t *testing.T) {
+	ctx := illygen.Context{"i64": int64(9), "f32": float32(1.5), "whole": 3.0, "text": "3"}
+	if got := ctx.Int("i64"); got != 9 {
+		t.Errorf("expected Int to read int64, got %d", got)
+	}
+	if got := ctx.Int("whole"); got != 3 {
+		t.Errorf("expected Int to read a whole float, got %d", got)
+	}
+	if got := ctx.Float("f32"); got != 1.5 {
+		t.Errorf("expected Float to read float32, got %f", got)
+	}
+	if got := ctx.Float("i64"); got != 9 {
+		t.Errorf("expected Float to read int64, got %f", got)
+	}
+	if _, ok := illygen.ToInt(ctx.Get("text")); ok {
+		t.Error("expected ToInt to reject strings")
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Context schema
+// ─────────────────────────────────────────────
+
+var (
+	schemaText   = illygen.NewKey[string]("text")
+	schemaIntent = illygen.NewKey[string]("intent")
+	schemaScore  = illygen.NewKey[float64]("score")
+)
+
+func schemaFlow() *illygen.Flow {
+	noop := func(ctx illygen.Context) illygen.Result { return illygen.Result{} }
+	return illygen.NewFlow().
+		Add(illygen.NewNode("classify", noop).Reads(schemaText.Field()).Writes(schemaIntent.Field())).
+		Add(illygen.NewNode("answer", noop).Reads(schemaIntent.Field(), schemaScore.Optional())).
+		Link("classify", "answer", 1.0).
+		Inputs(schemaText.Field(), schemaScore.Optional())
+}
+
+func TestFlow_Validate(t *testing.T) {
+	if err := schemaFlow().Validate(); err != nil {
+		t.Fatalf("expected a valid flow, got %v", err)
+	}
+}
+
+func TestFlow_Validate_MissingWriter(t *testing.T) {
+	noop := func(ctx illygen.Context) illygen.Result { return illygen.Result{} }
+	flow := illygen.NewFlow().
+		Add(illygen.NewNode("a", noop)).
+		Add(illygen.NewNode("b", noop).Reads(schemaIntent.Field())).
+		Link("a", "b", 1.0)
+
+	err := flow.Validate()
+	var se *illygen.SchemaError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected *SchemaError, got %v", err)
+	}
+	if se.NodeID != "b" || se.Key != "intent" {
+		t.Errorf("expected error for node b key intent, got %+v", se)
+	}
+}
+
+func TestFlow_Validate_OptionalReads(t *testing.T) {
+	noop := func(ctx illygen.Context) illygen.Result { return illygen.Result{} }
+	flow := illygen.NewFlow().
+		Add(illygen.NewNode("a", noop)).
+		Add(illygen.NewNode("b", noop).Reads(schemaScore.Optional())).
+		Link("a", "b", 1.0)
+	if err := flow.Validate(); err != nil {
+		t.Errorf("expected an optional read without a writer to be valid, got %v", err)
+	}
+
+	// An optional read that is written must still have a compatible type.
+	score := illygen.NewKey[string]("score")
+	flow = illygen.NewFlow().
+		Add(illygen.NewNode("a", noop).Writes(score.Field())).
+		Add(illygen.NewNode("b", noop).Reads(schemaScore.Optional())).
+		Link("a", "b", 1.0)
+	if err := flow.Validate(); err == nil {
+		t.Error("expected a type mismatch on an optional read")
+	}
+}
+
+func TestFlow_Validate_OnlyUpstreamWriters(t *testing.T) {
+	noop := func(ctx illygen.Context) illygen.Result { return illygen.Result{} }
+	// c writes intent, but only after b has read it.
+	flow := illygen.NewFlow().
+		Add(illygen.NewNode("a", noop)).
+		Add(illygen.NewNode("b", noop).Reads(schemaIntent.Field())).
+		Add(illygen.NewNode("c", noop).Writes(schemaIntent.Field())).
+		Link("a", "b", 1.0).
+		Link("b", "c", 1.0)
+
+	if err := flow.Validate(); err == nil {
+		t.Error("expected a downstream writer not to satisfy a read")
+	}
+}
+
+func TestFlow_Validate_TypeMismatch(t *testing.T) {
+	noop := func(ctx illygen.Context) illygen.Result { return illygen.Result{} }
+	count := illygen.NewKey[int]("intent")
+	flow := illygen.NewFlow().
+		Add(illygen.NewNode("a", noop).Writes(schemaIntent.Field())).
+		Add(illygen.NewNode("b", noop).Reads(count.Field())).
+		Link("a", "b", 1.0)
+
+	err := flow.Validate()
+	if err == nil || !strings.Contains(err.Error(), `node "a" writes it as string`) {
+		t.Errorf("expected a type mismatch error, got %v", err)
+	}
+}
+
+func TestFlow_Validate_NumericWidening(t *testing.T) {
+	noop := func(ctx illygen.Context) illygen.Result { return illygen.Result{} }
+	count := illygen.NewKey[int]("score")
+	flow := illygen.NewFlow().
+		Add(illygen.NewNode("a", noop).Writes(count.Field())).
+		Add(illygen.NewNode("b", noop).Reads(schemaScore.Field())).
+		Link("a", "b", 1.0)
+
+	if err := flow.Validate(); err != nil {
+		t.Errorf("expected int written and float64 read to be compatible, got %v", err)
+	}
+}
+
+func TestEngine_Run_ValidatesInputs(t *testing.T) {
+	engine := illygen.NewEngine()
+	flow := schemaFlow()
+
+	_, err := engine.Run(flow, illygen.Context{})
+	var se *illygen.SchemaError
+	if !errors.As(err, &se) || se.Key != "text" || se.NodeID != "" {
+		t.Fatalf("expected *SchemaError for missing input text, got %v", err)
+	}
+
+	_, err = engine.Run(flow, illygen.Context{"text": "hi", "score": "high"})
+	if !errors.As(err, &se) || se.Key != "score" {
+		t.Errorf("expected *SchemaError for mistyped optional input, got %v", err)
+	}
+
+	if _, err := engine.Run(flow, illygen.Context{"text": "hi", "score": 1}); err != nil {
+		t.Errorf("expected a whole int to satisfy a float64 input, got %v", err)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Context changes
+// ─────────────────────────────────────────────
+
+func changesFlow() *illygen.Flow {
+	return illygen.NewFlow().
+		Add(illygen.NewNode("classify", func(ctx illygen.Context) illygen.Result {
+			ctx.Set("intent", "unknown")
+			ctx.Set("tries", 1)
+			return illygen.Result{Next: "refine"}
+		})).
+		Add(illygen.NewNode("refine", func(ctx illygen.Context) illygen.Result {
+			ctx.Set("intent", "greeting")
+			delete(ctx, "text")
+			return illygen.Result{Value: "hi", Confidence: 0.9}
+		}))
+}
+
+func TestEngine_RecordChanges(t *testing.T) {
+	engine := illygen.NewEngine().RecordChanges(true)
+	trace, err := engine.RunTrace(changesFlow(), illygen.Context{"text": "hello"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	first := trace.Steps[0].Changes
+	if len(first) != 2 || first[0].Key != "intent" || first[0].Kind != illygen.ChangeAdded || first[0].After != "unknown" {
+		t.Errorf("expected classify to add intent and tries, got %+v", first)
+	}
+
+	second := trace.Steps[1].Changes
+	want := []illygen.Change{
+		{Key: "intent", Kind: illygen.ChangeChanged, Before: "unknown", After: "greeting"},
+		{Key: "text", Kind: illygen.ChangeRemoved, Before: "hello"},
+	}
+	if fmt.Sprint(second) != fmt.Sprint(want) {
+		t.Errorf("expected %+v, got %+v", want, second)
+	}
+	for _, c := range append(first, second...) {
+		if strings.HasPrefix(c.Key, "__") {
+			t.Errorf("expected internal keys to be ignored, got %q", c.Key)
+		}
+	}
+}
+
+func TestTrace_ContextAt(t *testing.T) {
+	engine := illygen.NewEngine().RecordChanges(true)
+	trace, err := engine.RunTrace(changesFlow(), illygen.Context{"text": "hello"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if trace.Initial.String("text") != "hello" || trace.Initial.Has("intent") {
+		t.Errorf("expected Initial to hold the input only, got %v", trace.Initial)
+	}
+	at0 := trace.ContextAt(0)
+	if at0.String("intent") != "unknown" || at0.String("text") != "hello" {
+		t.Errorf("expected the Context after classify, got %v", at0)
+	}
+	at1 := trace.ContextAt(1)
+	if at1.String("intent") != "greeting" || at1.Has("text") || at1.Int("tries") != 1 {
+		t.Errorf("expected the final Context, got %v", at1)
+	}
+	if trace.ContextAt(2) != nil {
+		t.Error("expected nil for an out-of-range step")
+	}
+}
+
+func TestEngine_RecordChanges_Off(t *testing.T) {
+	trace, err := illygen.NewEngine().RunTrace(changesFlow(), illygen.Context{"text": "hello"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if trace.Steps[0].Changes != nil || trace.Initial != nil || trace.ContextAt(0) != nil {
+		t.Error("expected no changes recorded by default")
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Checkpoint & resume
+// ─────────────────────────────────────────────
+
+// approvalFlow drafts a reply, suspends for a human to approve it, then sends it.
+func approvalFlow() *illygen.Flow {
+	return illygen.NewFlow().
+		Add(illygen.NewNode("draft", func(ctx illygen.Context) illygen.Result {
+			ctx.Set("draft", "hello "+ctx.String("name"))
+			illygen.FlowMemory(ctx).Set("drafted", true)
+			return illygen.Result{Value: "awaiting approval", Suspend: true}
+		})).
+		Add(illygen.NewNode("send", func(ctx illygen.Context) illygen.Result {
+			if !ctx.Bool("approved") {
+				return illygen.Result{Value: "discarded", Confidence: 1}
+			}
+			if illygen.FlowMemory(ctx).Get("drafted") != true {
+				return illygen.Result{Value: "flow memory lost"}
+			}
+			return illygen.Result{Value: ctx.String("draft"), Confidence: 1}
+		})).
+		Link("draft", "send", 1.0).
+		Named("approval")
+}
+
+func TestEngine_SuspendAndResume(t *testing.T) {
+	trace, err := illygen.NewEngine().RunTrace(approvalFlow(), illygen.Context{"name": "ada"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !trace.Suspended || !trace.Result.Suspend || len(trace.Steps) != 1 {
+		t.Fatalf("expected the run to suspend after draft, got %+v", trace)
+	}
+	data, err := trace.Checkpoint()
+	if err != nil {
+		t.Fatalf("checkpoint: %v", err)
+	}
+
+	// Resume on another engine, with a freshly built copy of the flow.
+	resumed, err := illygen.NewEngine().Resume(approvalFlow(), data, illygen.Context{"approved": true})
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if resumed.Suspended || resumed.Result.Value != "hello ada" {
+		t.Errorf("expected the approved draft, got %+v", resumed.Result)
+	}
+	if len(resumed.Steps) != 2 || resumed.Steps[0].NodeID != "draft" || resumed.Steps[1].NodeID != "send" {
+		t.Errorf("expected the resumed trace to continue the suspended one, got %+v", resumed.Steps)
+	}
+	if _, err := resumed.Checkpoint(); err == nil {
+		t.Error("expected an error checkpointing a finished run")
+	}
+}
+
+func TestEngine_Checkpoint_JSONValues(t *testing.T) {
+	var profile map[string]any
+	if err := json.Unmarshal([]byte(`{"name":"ada","tags":["a",{"k":1}],"prefs":{"lang":"en"}}`), &profile); err != nil {
+		t.Fatal(err)
+	}
+	trace, err := illygen.NewEngine().RunTrace(approvalFlow(), illygen.Context{
+		"name":    "ada",
+		"profile": profile,
+		"history": []any{"hi", 2.0, illygen.Context{"nested": true}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := trace.Checkpoint()
+	if err != nil {
+		t.Fatalf("checkpoint: %v", err)
+	}
+
+	resumed, err := illygen.NewEngine().Resume(approvalFlow(), data, illygen.Context{"approved": true})
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if !reflect.DeepEqual(resumed.Context.Get("profile"), profile) {
+		t.Errorf("expected the JSON profile to round-trip, got %#v", resumed.Context.Get("profile"))
+	}
+	if history := resumed.Context.Get("history").([]any); history[2].(illygen.Context)["nested"] != true {
+		t.Errorf("expected the nested Context to round-trip, got %#v", history)
+	}
+}
+
+func TestEngine_Run_Suspend(t *testing.T) {
+	res, err := illygen.NewEngine().Run(approvalFlow(), illygen.Context{"name": "ada"})
+	if err != nil || !res.Suspend || res.Value != "awaiting approval" {
+		t.Errorf("expected Run to return the suspending Result, got %+v (err=%v)", res, err)
+	}
+}
+
+func TestEngine_Resume_IncompatibleFlow(t *testing.T) {
+	trace, _ := illygen.NewEngine().RunTrace(approvalFlow(), illygen.Context{"name": "ada"})
+	data, _ := trace.Checkpoint()
+	engine := illygen.NewEngine()
+
+	changed := approvalFlow().Add(illygen.NewNode("audit", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{}
+	}))
+	var ce *illygen.CheckpointError
+	if _, err := engine.Resume(changed, data, nil); !errors.As(err, &ce) {
+		t.Errorf("expected *CheckpointError for a flow with another node, got %v", err)
+	}
+	if _, err := engine.Resume(approvalFlow().Version("2"), data, nil); !errors.As(err, &ce) {
+		t.Errorf("expected *CheckpointError for another flow version, got %v", err)
+	}
+	if _, err := engine.Resume(approvalFlow(), []byte("garbage"), nil); !errors.As(err, &ce) {
+		t.Errorf("expected *CheckpointError for a corrupt checkpoint, got %v", err)
+	}
+
+	// Link weights change as a flow learns; they must not invalidate checkpoints.
+	relinked := approvalFlow()
+	relinked.Feedback(trace, 1)
+	if _, err := engine.Resume(relinked, data, illygen.Context{"approved": true}); err != nil {
+		t.Errorf("expected learned stats not to affect compatibility, got %v", err)
+	}
+}
+
+func TestEngine_Resume_KeepsLimits(t *testing.T) {
+	// Each visit to loop suspends; visits must accumulate across resumes.
+	flow := illygen.NewFlow().Add(illygen.NewNode("loop", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{Next: "loop", Suspend: true}
+	}))
+	engine := illygen.NewEngine().Limits(illygen.Limits{MaxVisits: 3})
+
+	trace, err := engine.RunTrace(flow, nil)
+	for i := 0; err == nil && trace.Suspended; i++ {
+		if i > 5 {
+			t.Fatal("expected the visit limit to stop the resumed run")
+		}
+		data, cerr := trace.Checkpoint()
+		if cerr != nil {
+			t.Fatalf("checkpoint: %v", cerr)
+		}
+		trace, err = engine.Resume(flow, data, nil)
+	}
+	var ce *illygen.CycleError
+	if !errors.As(err, &ce) {
+		t.Errorf("expected *CycleError across resumes, got %v", err)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Record & replay
+// ─────────────────────────────────────────────
+
+// diceFlow rolls with the run's randomness, stamps the time, then lets
+// Softmax routing pick hi or lo.
+func diceFlow(bias float64) *illygen.Flow {
+	return illygen.NewFlow().
+		Add(illygen.NewNode("roll", func(ctx illygen.Context) illygen.Result {
+			roll := illygen.Random(ctx).Float64() + bias
+			ctx.Set("at", illygen.Now(ctx))
+			return illygen.Result{Value: roll, Confidence: 0.5}
+		})).
+		Add(illygen.NewNode("hi", func(ctx illygen.Context) illygen.Result {
+			return illygen.Result{Value: "hi", Confidence: 1}
+		})).
+		Add(illygen.NewNode("lo", func(ctx illygen.Context) illygen.Result {
+			return illygen.Result{Value: "lo", Confidence: 1}
+		})).
+		Link("roll", "hi", 0.5).
+		Link("roll", "lo", 0.5)
+}
+
+func TestEngine_RecordAndReplay(t *testing.T) {
+	engine := illygen.NewEngine().Routing(illygen.Softmax(1)).RecordRuns(true)
+	trace, err := engine.RunTrace(diceFlow(0), illygen.Context{"user": "ada"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := trace.Recording
+	if rec == nil || len(rec.Steps) != 2 || rec.Input.String("user") != "ada" {
+		t.Fatalf("expected a two-step recording, got %+v", rec)
+	}
+	if len(rec.Steps[0].Draws) != 2 || len(rec.Steps[0].Times) != 1 {
+		t.Errorf("expected the roll step to record its own and routing's draws and one time, got %+v", rec.Steps[0])
+	}
+
+	var buf bytes.Buffer
+	if err := rec.Save(&buf); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, err := illygen.LoadRecording(&buf)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	// A differently seeded engine must still replay the same path.
+	res := illygen.NewEngine().Routing(illygen.Softmax(1)).Seed(99).Replay(diceFlow(0), loaded)
+	if res.Divergence != nil {
+		t.Fatalf("expected an identical replay, got %v", res.Divergence)
+	}
+	if res.Trace.Result.Value != trace.Result.Value || !res.Trace.Context.Get("at").(time.Time).Equal(rec.Steps[0].Times[0]) {
+		t.Errorf("expected the replay to reproduce the recorded run")
+	}
+}
+
+func TestRecording_SaveJSONValues(t *testing.T) {
+	flow := illygen.NewFlow().Add(illygen.NewNode("echo", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{Value: []any{ctx.Get("query"), map[string]any{"ok": true}}, Confidence: 1}
+	}))
+	engine := illygen.NewEngine().RecordRuns(true)
+	trace, err := engine.RunTrace(flow, illygen.Context{"query": map[string]any{"terms": []any{"a", 1.0}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := trace.Recording.Save(&buf); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, err := illygen.LoadRecording(&buf)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Input, trace.Recording.Input) || !reflect.DeepEqual(loaded.Steps[0].Value, trace.Steps[0].Value) {
+		t.Errorf("expected JSON-shaped input and values to round-trip, got %#v and %#v", loaded.Input, loaded.Steps[0].Value)
+	}
+	if res := engine.Replay(flow, loaded); res.Divergence != nil {
+		t.Errorf("expected the loaded recording to replay, got %v", res.Divergence)
+	}
+}
+
+func TestEngine_Replay_Divergence(t *testing.T) {
+	engine := illygen.NewEngine().RecordRuns(true)
+	trace, err := engine.RunTrace(diceFlow(0), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res := engine.Replay(diceFlow(1), trace.Recording)
+	d := res.Divergence
+	if d == nil || d.Step != 0 || d.Want == nil || d.Got == nil || !strings.Contains(d.Reason, "returned value") {
+		t.Errorf("expected a value divergence at step 0, got %+v", d)
+	}
+
+	hungry := diceFlow(0)
+	hungry.Add(illygen.NewNode("roll", func(ctx illygen.Context) illygen.Result {
+		illygen.Random(ctx).Float64()
+		illygen.Random(ctx).Float64()
+		return illygen.Result{}
+	}))
+	d = engine.Replay(hungry, trace.Recording).Divergence
+	if d == nil || d.Step != 0 || !strings.Contains(d.Reason, "more random numbers") {
+		t.Errorf("expected extra randomness to diverge at step 0, got %+v", d)
+	}
+}
+
+func TestEngine_RecordRuns_FailedRun(t *testing.T) {
+	var rec *illygen.Recording
+	engine := illygen.NewEngine().RecordRuns(true).Limits(illygen.Limits{MaxSteps: 3}).Hooks(illygen.Hooks{
+		OnRunEnd: func(run *illygen.RunInfo, _ *illygen.Trace, err error) { rec = run.Recording },
+	})
+	_, err := engine.RunTrace(countingLoop(10), nil)
+	if err == nil {
+		t.Fatal("expected the step limit to fail the run")
+	}
+	if rec == nil || len(rec.Steps) != 3 || rec.Err != err.Error() {
+		t.Fatalf("expected the failed run to be recorded, got %+v", rec)
+	}
+	if d := engine.Replay(countingLoop(10), rec).Divergence; d != nil {
+		t.Errorf("expected the failure to replay identically, got %v", d)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Explanations
+// ─────────────────────────────────────────────
+
+// lowest is a Strategy that always explores the lowest-weight Link.
+type lowest struct{}
+
+func (lowest) Choose(_ string, edges []illygen.Edge, _ illygen.Rand) illygen.Edge {
+	return edges[len(edges)-1]
+}
+
+func TestEngine_Explain(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	_ = store.Add("g1", "greetings", map[string]any{"response": "hi"})
+	_ = store.Add("g2", "greetings", map[string]any{"response": "hello"})
+
+	flow := illygen.NewFlow().
+		Add(illygen.NewNode("input", func(ctx illygen.Context) illygen.Result {
+			return illygen.Result{Next: "answer", Confidence: 0.6}
+		})).
+		Add(illygen.NewNode("answer", func(ctx illygen.Context) illygen.Result {
+			units := illygen.Knowledge(ctx).Domain("greetings")
+			return illygen.Result{Value: units[0].Fact("response"), Confidence: 0.9}
+		})).
+		Named("greet")
+
+	engine := illygen.NewEngine(store)
+	trace, err := engine.RunTrace(flow, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := trace.Steps[1].Knowledge; len(got) != 2 {
+		t.Errorf("expected answer to have consulted both units, got %v", got)
+	}
+	if trace.Steps[0].Knowledge != nil {
+		t.Errorf("expected input to have consulted nothing, got %v", trace.Steps[0].Knowledge)
+	}
+
+	x := trace.Explain()
+	if strings.Join(x.Path, ",") != "input,answer" {
+		t.Errorf("expected path input,answer, got %v", x.Path)
+	}
+	if x.Steps[0].Choice != illygen.ChoiceNext || x.Steps[1].Choice != illygen.ChoiceEnd {
+		t.Errorf("expected explicit-next then end, got %s, %s", x.Steps[0].Choice, x.Steps[1].Choice)
+	}
+	if d := x.Steps[1].Contribution; d < 0.29 || d > 0.31 {
+		t.Errorf("expected answer to contribute +0.3 confidence, got %f", d)
+	}
+
+	text := x.String()
+	for _, want := range []string{`Flow "greet": input → answer`, `set Next to "answer" explicitly`, "consulted g1, g2", "Result: hi"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected text explanation to contain %q, got:\n%s", want, text)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := x.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	var decoded illygen.Explanation
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded.Steps[1].Knowledge[0] != "g1" {
+		t.Errorf("expected the JSON explanation to round-trip, got %+v (err=%v)", decoded, err)
+	}
+}
+
+func TestEngine_Explain_LinkChoices(t *testing.T) {
+	flow := branchFlow()
+	for strategy, want := range map[illygen.Strategy]illygen.Choice{
+		illygen.Greedy():         illygen.ChoiceHighestWeight,
+		illygen.EpsilonGreedy(0): illygen.ChoiceStrategy,
+		lowest{}:                 illygen.ChoiceExplored,
+		illygen.Softmax(0):       illygen.ChoiceHighestWeight,
+	} {
+		engine := illygen.NewEngine().Routing(strategy).Seed(1)
+		trace, err := engine.RunTrace(flow, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		step := trace.Explain().Steps[0]
+		if step.Choice != want || step.Links != 2 {
+			t.Errorf("expected %s over 2 links, got %+v", want, step)
+		}
+	}
+}
+
+func TestTrace_Explain_RecordsLinksAtRunTime(t *testing.T) {
+	flow := branchFlow()
+	trace, err := illygen.NewEngine().RunTrace(flow, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A Link added after the run must not change how the run is explained.
+	flow.Add(illygen.NewNode("new", func(ctx illygen.Context) illygen.Result {
+		return illygen.Result{}
+	})).Link("a", "new", 0.95)
+
+	step := trace.Explain().Steps[0]
+	if step.Choice != illygen.ChoiceHighestWeight || step.Links != 2 || step.Weight != 0.9 {
+		t.Errorf("expected highest-weight over the 2 links the run saw, got %+v", step)
+	}
+	if s := trace.Steps[0]; s.Strategy != "greedy" || len(s.Links) != 2 {
+		t.Errorf("expected the step to record greedy routing over 2 links, got %q over %v", s.Strategy, s.Links)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Why not
+// ─────────────────────────────────────────────
+
+// detourFlow routes greedily start → a → x; farewell is reachable from a
+// and from b.
+func detourFlow() *illygen.Flow {
+	leaf := func(id string) *illygen.Node {
+		return illygen.NewNode(id, func(ctx illygen.Context) illygen.Result {
+			return illygen.Result{Value: id, Confidence: 1}
+		})
+	}
+	return illygen.NewFlow().
+		Add(leaf("start")).Add(leaf("a")).Add(leaf("b")).Add(leaf("x")).Add(leaf("farewell")).
+		Link("start", "a", 0.7).
+		Link("start", "b", 0.3).
+		Link("a", "x", 0.6).
+		Link("a", "farewell", 0.4).
+		Link("b", "farewell", 1.0)
+}
+
+func TestEngine_WhyNot(t *testing.T) {
+	flow := detourFlow()
+	engine := illygen.NewEngine()
+	trace, err := engine.RunTrace(flow, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w, err := engine.WhyNot(flow, trace, "farewell")
+	if err != nil {
+		t.Fatalf("WhyNot: %v", err)
+	}
+	if w.Reached || len(w.Steps) != 3 {
+		t.Fatalf("expected 3 unreached steps, got %+v", w)
+	}
+	first := w.Steps[0]
+	if first.Chosen.To != "a" || first.Chosen.Weight != 0.7 || len(first.Others) != 1 ||
+		first.Others[0].To != "b" || !first.Others[0].Reaches {
+		t.Errorf("expected start to have chosen a over b (which reaches farewell), got %+v", first)
+	}
+
+	// Raising a → farewell by 0.2 beats raising start → b by 0.4.
+	c := w.Weights
+	if c == nil || c.Step != 1 || len(c.Links) != 1 {
+		t.Fatalf("expected a single link change at step 1, got %+v", c)
+	}
+	l := c.Links[0]
+	if l.From != "a" || l.To != "farewell" || l.Exceed != 0.6 || math.Abs(l.Delta-0.2) > 1e-9 {
+		t.Errorf("expected to raise a → farewell above 0.6, got %+v", l)
+	}
+
+	if _, err := engine.WhyNot(flow, trace, "missing"); err == nil {
+		t.Error("expected an error for a target outside the flow")
+	}
+}
+
+func TestEngine_WhyNot_ExplicitNext(t *testing.T) {
+	intent := illygen.NewKey[string]("intent")
+	flow := illygen.NewFlow().
+		Add(illygen.NewNode("route", func(ctx illygen.Context) illygen.Result {
+			if intent.MustGet(ctx) == "bye" {
+				return illygen.Result{Next: "farewell"}
+			}
+			return illygen.Result{Next: "greet"}
+		}).Reads(intent.Field())).
+		Add(illygen.NewNode("greet", func(ctx illygen.Context) illygen.Result {
+			return illygen.Result{Value: "hello"}
+		})).
+		Add(illygen.NewNode("farewell", func(ctx illygen.Context) illygen.Result {
+			return illygen.Result{Value: "goodbye"}
+		}))
+
+	engine := illygen.NewEngine().RecordChanges(true)
+	trace, err := engine.RunTrace(flow, illygen.Context{"intent": "hi"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w, err := engine.WhyNotValue(flow, trace, trace.Initial, "goodbye")
+	if err == nil {
+		t.Fatalf("expected no path to return goodbye for this input, got %+v", w)
+	}
+
+	w, err = engine.WhyNot(flow, trace, "farewell")
+	if err != nil {
+		t.Fatalf("WhyNot: %v", err)
+	}
+	if w.Weights != nil {
+		t.Errorf("expected no weight change to help an explicit route, got %+v", w.Weights)
+	}
+	if len(w.Decisions) != 1 || w.Decisions[0].NodeID != "route" || w.Decisions[0].Values.String("intent") != "hi" {
+		t.Errorf("expected the route node's reads to be reported, got %+v", w.Decisions)
+	}
+}
+
+func TestEngine_WhyNotValue(t *testing.T) {
+	flow := detourFlow()
+	engine := illygen.NewEngine()
+	trace, _ := engine.RunTrace(flow, nil)
+
+	w, err := engine.WhyNotValue(flow, trace, illygen.Context{}, "farewell")
+	if err != nil {
+		t.Fatalf("WhyNotValue: %v", err)
+	}
+	if w.Target != "farewell" || w.Weights == nil {
+		t.Errorf("expected the farewell node to be targeted, got %+v", w)
+	}
+}
+
+func TestEngine_WhyNot_NilTrace(t *testing.T) {
+	flow := detourFlow()
+	engine := illygen.NewEngine()
+	if _, err := engine.WhyNot(flow, nil, "farewell"); err == nil {
+		t.Error("expected an error for a nil trace")
+	}
+	if _, err := engine.WhyNotValue(flow, nil, illygen.Context{}, "farewell"); err == nil {
+		t.Error("expected an error for a nil trace")
+	}
+}
+
+func TestEngine_Replay_NilRecording(t *testing.T) {
+	res := illygen.NewEngine().Replay(diceFlow(0), nil)
+	if res.Err == nil || res.Trace != nil {
+		t.Errorf("expected an error and no trace for a nil recording, got %+v", res)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Knowledge auditing
+// ─────────────────────────────────────────────
+
+func TestKnowledge_Audit(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	_ = store.Add("en", "greetings", map[string]any{"lang": "en", "response": "hi"})
+	_ = store.Add("fr", "greetings", map[string]any{"lang": "fr", "response": "salut"})
+	_ = store.Add("bye", "farewells", map[string]any{"response": "bye"})
+
+	flow := illygen.NewFlow().
+		Add(illygen.NewNode("lookup", func(ctx illygen.Context) illygen.Result {
+			ks := illygen.Knowledge(ctx)
+			ks.Get("missing")
+			units := ks.Find("greetings", func(u *illygen.KnowledgeUnit) bool { return u.Fact("lang") == "fr" })
+			return illygen.Result{Value: units[0].Fact("response"), Next: "close"}
+		})).
+		Add(illygen.NewNode("close", func(ctx illygen.Context) illygen.Result {
+			illygen.Knowledge(ctx).Domain("farewells")
+			illygen.Knowledge(ctx).Get("fr")
+			return illygen.Result{Value: "done"}
+		}))
+
+	trace, err := illygen.NewEngine(store).RunTrace(flow, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lookup := trace.Steps[0]
+	want := []illygen.KnowledgeAccess{
+		{Op: "get", Query: "missing"},
+		{Op: "find", Query: "greetings", Units: []string{"fr"}},
+	}
+	if fmt.Sprint(lookup.Accesses) != fmt.Sprint(want) {
+		t.Errorf("expected accesses %v, got %v", want, lookup.Accesses)
+	}
+	if strings.Join(lookup.Knowledge, ",") != "fr" {
+		t.Errorf("expected only the matching unit to be consulted, got %v", lookup.Knowledge)
+	}
+	if got := strings.Join(trace.Knowledge(), ","); got != "fr,bye" {
+		t.Errorf("expected fr,bye consulted across the run, got %s", got)
+	}
+}
+
+func TestKnowledge_StoreOutsideRunIsNotAudited(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	_ = store.Add("a", "d", nil)
+	if units := store.Find("d", func(*illygen.KnowledgeUnit) bool { return true }); len(units) != 1 {
+		t.Errorf("expected Find to work on the store directly, got %v", units)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Knowledge reinforcement
+// ─────────────────────────────────────────────
+
+// consultingRun runs a flow whose single node consults every unit of domain d.
+func consultingRun(t *testing.T, store *illygen.KnowledgeStore) *illygen.Trace {
+	t.Helper()
+	flow := illygen.NewFlow().Add(illygen.NewNode("n", func(ctx illygen.Context) illygen.Result {
+		illygen.Knowledge(ctx).Domain("d")
+		return illygen.Result{}
+	}))
+	trace, err := illygen.NewEngine(store).RunTrace(flow, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return trace
+}
+
+func unitWeight(store *illygen.KnowledgeStore, id string) float64 {
+	u, _ := store.Get(id)
+	return u.Weight
+}
+
+func TestKnowledge_Reinforce(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	_ = store.Add("a", "d", nil)
+	_ = store.Add("other", "x", nil)
+	trace := consultingRun(t, store)
+
+	opts := illygen.Reinforcement{Rate: 0.5, Floor: 0.2}
+	if changed := store.Reinforce(trace, -1, opts); len(changed) != 1 || changed[0].ID != "a" {
+		t.Fatalf("expected only the consulted unit to change, got %v", changed)
+	}
+	if w := unitWeight(store, "a"); math.Abs(w-0.6) > 1e-9 {
+		t.Errorf("expected 1.0 → 0.6 (half way to the floor), got %f", w)
+	}
+	if w := unitWeight(store, "other"); w != 1.0 {
+		t.Errorf("expected an unconsulted unit to keep its weight, got %f", w)
+	}
+
+	for i := 0; i < 50; i++ {
+		store.Reinforce(trace, -1, opts)
+	}
+	if w := unitWeight(store, "a"); w < 0.2 {
+		t.Errorf("expected the weight to stay above the floor, got %f", w)
+	}
+
+	store.Reinforce(trace, 1, illygen.Reinforcement{Rate: 0.5, Ceiling: 0.8})
+	if w := unitWeight(store, "a"); w > 0.8 {
+		t.Errorf("expected the weight to stay below the ceiling, got %f", w)
+	}
+}
+
+func TestKnowledge_ReinforceTrained(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	if err := store.Train("t", "d", nil, 0.7); err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+	trace := consultingRun(t, store)
+
+	store.Reinforce(trace, 1)
+	boosted := unitWeight(store, "t")
+	if boosted <= 0.7 {
+		t.Errorf("expected a trained unit to be boosted, got %f", boosted)
+	}
+	for i := 0; i < 100; i++ {
+		store.Reinforce(trace, -1, illygen.Reinforcement{Rate: 1})
+	}
+	if w := unitWeight(store, "t"); w != 0.7 {
+		t.Errorf("expected a trained unit never to fall below its trained weight, got %f", w)
+	}
+}
+
+func TestKnowledge_ReinforceKeepsHeldUnits(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	_ = store.Add("a", "d", nil)
+	held, _ := store.Get("a")
+	store.Reinforce(consultingRun(t, store), -1)
+	if held.Weight != 1.0 {
+		t.Errorf("expected a unit already handed out not to change, got %f", held.Weight)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Knowledge decay & TTL
+// ─────────────────────────────────────────────
+
+func TestKnowledge_TTL(t *testing.T) {
+	clock := illygen.NewManualClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := illygen.NewKnowledgeStore().Clock(clock).DomainTTL("promotions", time.Hour)
+	_ = store.Add("sale", "promotions", nil)
+	_ = store.Add("flash", "promotions", nil)
+	_ = store.Add("faq", "help", nil)
+	if err := store.SetTTL("flash", 10*time.Minute); err != nil {
+		t.Fatalf("SetTTL: %v", err)
+	}
+
+	clock.Advance(10 * time.Minute)
+	if _, ok := store.Get("flash"); ok {
+		t.Error("expected flash to expire after its own TTL")
+	}
+	if units := store.Domain("promotions"); len(units) != 1 || units[0].ID != "sale" {
+		t.Errorf("expected only sale to be left, got %v", units)
+	}
+
+	clock.Advance(time.Hour)
+	if n := store.Size(); n != 1 {
+		t.Errorf("expected only the unit without a TTL to be left, got %d", n)
+	}
+	if removed := store.Sweep(); removed != 2 {
+		t.Errorf("expected Sweep to remove 2 expired units, got %d", removed)
+	}
+	if err := store.SetTTL("sale", time.Hour); err == nil {
+		t.Error("expected SetTTL to fail for a swept unit")
+	}
+}
+
+func TestKnowledge_Decay(t *testing.T) {
+	clock := illygen.NewManualClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := illygen.NewKnowledgeStore().Clock(clock).Decay("outages", time.Hour)
+	_ = store.Add("old", "outages", nil)
+	clock.Advance(time.Hour)
+	_ = store.Add("new", "outages", nil)
+	_ = store.Train("known", "outages", nil, 0.8)
+
+	if w := unitWeight(store, "old"); math.Abs(w-0.5) > 1e-9 {
+		t.Errorf("expected one half-life to halve the weight, got %f", w)
+	}
+	clock.Advance(time.Hour)
+	units := store.Domain("outages")
+	if units[0].ID != "known" || units[1].ID != "new" || units[2].ID != "old" {
+		t.Errorf("expected units ordered by decayed weight, got %s %s %s", units[0].ID, units[1].ID, units[2].ID)
+	}
+	if units[0].Weight != 0.8 {
+		t.Errorf("expected a trained unit not to decay below its trained weight, got %f", units[0].Weight)
+	}
+
+	// Sweep writes decay back; it must not be applied twice.
+	store.Sweep()
+	if w := unitWeight(store, "old"); math.Abs(w-0.25) > 1e-9 {
+		t.Errorf("expected 0.25 after two half-lives and a sweep, got %f", w)
+	}
+	clock.Advance(time.Hour)
+	if w := unitWeight(store, "old"); math.Abs(w-0.125) > 1e-9 {
+		t.Errorf("expected 0.125 after three half-lives, got %f", w)
+	}
+}
+
+func TestKnowledge_ReinforceKeepsTTL(t *testing.T) {
+	clock := illygen.NewManualClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := illygen.NewKnowledgeStore().Clock(clock).DomainTTL("d", time.Hour)
+	_ = store.Add("k1", "d", nil)
+	added, _ := store.Get("k1")
+
+	for i := 0; i < 2; i++ {
+		clock.Advance(25 * time.Minute)
+		if changed := store.Reinforce(consultingRun(t, store), -1); len(changed) != 1 {
+			t.Fatalf("expected k1 reweighted, got %v", changed)
+		}
+	}
+	u, _ := store.Get("k1")
+	if !u.Updated.Equal(added.Updated) || !u.Reweighted.Equal(clock.Now()) {
+		t.Errorf("expected Reweighted stamped and Updated kept, got %v and %v", u.Reweighted, u.Updated)
+	}
+	clock.Advance(10 * time.Minute)
+	if _, ok := store.Get("k1"); ok {
+		t.Error("expected a reinforced unit to expire an hour after it was added")
+	}
+}
+
+func TestKnowledge_ReinforceDecays(t *testing.T) {
+	clock := illygen.NewManualClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := illygen.NewKnowledgeStore().Clock(clock).Decay("d", time.Hour)
+	_ = store.Add("k1", "d", nil)
+
+	clock.Advance(time.Hour)
+	store.Reinforce(consultingRun(t, store), 1) // 0.5 → 0.55
+	if w := unitWeight(store, "k1"); math.Abs(w-0.55) > 1e-9 {
+		t.Fatalf("expected the decayed weight to be reinforced, got %f", w)
+	}
+	clock.Advance(time.Hour)
+	if w := unitWeight(store, "k1"); math.Abs(w-0.275) > 1e-9 {
+		t.Errorf("expected the reinforced weight to keep decaying, got %f", w)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Knowledge history
+// ─────────────────────────────────────────────
+
+func TestKnowledge_History(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := illygen.NewManualClock(start)
+	store := illygen.NewKnowledgeStore().Clock(clock)
+	_ = store.As("seed").Add("k1", "greetings", map[string]any{"response": "Hi"})
+	clock.Advance(time.Minute)
+	if err := store.As("alice").Update("k1", map[string]any{"response": "Hello"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	clock.Advance(time.Minute)
+	if err := store.Delete("k1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	history := store.History("k1")
+	if len(history) != 3 {
+		t.Fatalf("expected 3 versions, got %d", len(history))
+	}
+	want := []struct {
+		kind   illygen.VersionKind
+		author string
+	}{{illygen.VersionAdded, "seed"}, {illygen.VersionUpdated, "alice"}, {illygen.VersionDeleted, ""}}
+	for i, w := range want {
+		v := history[i]
+		if v.Version != i+1 || v.Kind != w.kind || v.Author != w.author || !v.Time.Equal(start.Add(time.Duration(i)*time.Minute)) {
+			t.Errorf("version %d: got %+v", i+1, v)
+		}
+	}
+	if history[1].Unit.Fact("response") != "Hello" || history[1].Unit.Version != 2 {
+		t.Errorf("expected version 2 to hold the update, got %+v", history[1].Unit)
+	}
+	if history[2].Unit != nil {
+		t.Error("expected the deletion to have no unit")
+	}
+	if store.History("missing") != nil {
+		t.Error("expected no history for a unit that never existed")
+	}
+}
+
+func TestKnowledge_AsOf(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := illygen.NewManualClock(start)
+	store := illygen.NewKnowledgeStore().Clock(clock)
+	_ = store.Add("k1", "greetings", map[string]any{"response": "Hi"})
+	clock.Advance(time.Minute)
+	_ = store.Update("k1", map[string]any{"response": "Hello"})
+	_ = store.Add("k2", "greetings", nil)
+	clock.Advance(time.Minute)
+	_ = store.Delete("k1")
+
+	before := store.AsOf(start.Add(-time.Second))
+	if before.Size() != 0 {
+		t.Errorf("expected an empty store before the first add, got %d units", before.Size())
+	}
+	first := store.AsOf(start.Add(30 * time.Second))
+	if u, ok := first.Get("k1"); !ok || u.Fact("response") != "Hi" {
+		t.Errorf("expected the first version of k1, got %v", u)
+	}
+	if units := first.Domain("greetings"); len(units) != 1 {
+		t.Errorf("expected only k1 before k2 was added, got %d units", len(units))
+	}
+	second := store.AsOf(start.Add(time.Minute))
+	if u, ok := second.Get("k1"); !ok || u.Fact("response") != "Hello" {
+		t.Errorf("expected the updated k1, got %v", u)
+	}
+	if len(second.History("k1")) != 2 {
+		t.Errorf("expected the view's history to stop at its time")
+	}
+	if _, ok := store.AsOf(clock.Now()).Get("k1"); ok {
+		t.Error("expected k1 to be gone after its deletion")
+	}
+
+	if err := second.Add("k3", "greetings", nil); err == nil {
+		t.Error("expected changes through an AsOf view to fail")
+	}
+	if err := second.Revert("k1", 1); err == nil {
+		t.Error("expected Revert through an AsOf view to fail")
+	}
+}
+
+func TestKnowledge_Revert(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	_ = store.Add("k1", "greetings", map[string]any{"response": "Hi"})
+	_ = store.Update("k1", map[string]any{"response": "Hello"})
+	_ = store.Delete("k1")
+
+	if err := store.As("bob").Revert("k1", 1); err != nil {
+		t.Fatalf("Revert: %v", err)
+	}
+	u, ok := store.Get("k1")
+	if !ok || u.Fact("response") != "Hi" || u.Version != 4 {
+		t.Fatalf("expected k1 restored to its first facts as version 4, got %+v", u)
+	}
+	last := store.History("k1")[3]
+	if last.Kind != illygen.VersionReverted || last.Author != "bob" {
+		t.Errorf("expected a reverted version by bob, got %+v", last)
+	}
+
+	if err := store.Revert("k1", 3); err != nil {
+		t.Fatalf("Revert to deletion: %v", err)
+	}
+	if _, ok := store.Get("k1"); ok {
+		t.Error("expected reverting to a deletion to delete the unit")
+	}
+	if err := store.Revert("k1", 9); err == nil {
+		t.Error("expected an error for a version that does not exist")
+	}
+}
+
+func TestKnowledge_ReinforceVersions(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	_ = store.Add("k1", "d", nil)
+	store.Reinforce(consultingRun(t, store), -1)
+
+	history := store.History("k1")
+	if len(history) != 2 || history[1].Kind != illygen.VersionReweighted {
+		t.Fatalf("expected reinforcement to add a reweighted version, got %+v", history)
+	}
+	if history[0].Unit.Weight != 1.0 || history[1].Unit.Weight >= 1.0 {
+		t.Errorf("expected versions to keep their own weights, got %f and %f", history[0].Unit.Weight, history[1].Unit.Weight)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Knowledge batches
+// ─────────────────────────────────────────────
+
+func TestKnowledgeBatch_Commit(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	_ = store.Add("old", "greetings", nil)
+	_ = store.Add("g0", "greetings", map[string]any{"response": "Hi"})
+
+	b := store.As("importer").Batch().
+		Add("g1", "greetings", map[string]any{"response": "Hey"}).
+		Update("g1", map[string]any{"response": "Hey there"}).
+		Update("g0", map[string]any{"response": "Hello"}).
+		Train("g2", "greetings", nil, 0.7).
+		Delete("old")
+	if b.Len() != 5 {
+		t.Errorf("expected 5 staged changes, got %d", b.Len())
+	}
+	if store.Size() != 2 {
+		t.Error("expected nothing to be written before Commit")
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	if u, _ := store.Get("g1"); u == nil || u.Fact("response") != "Hey there" || u.Version != 2 {
+		t.Errorf("expected g1 added then updated, got %+v", u)
+	}
+	if u, _ := store.Get("g0"); u == nil || u.Fact("response") != "Hello" {
+		t.Errorf("expected g0 updated, got %+v", u)
+	}
+	if u, _ := store.Get("g2"); u == nil || !u.Trained || u.Weight != 0.7 {
+		t.Errorf("expected g2 trained, got %+v", u)
+	}
+	if _, ok := store.Get("old"); ok {
+		t.Error("expected old to be deleted")
+	}
+	if v := store.History("g0")[1]; v.Author != "importer" {
+		t.Errorf("expected the batch's author on its versions, got %q", v.Author)
+	}
+	if b.Len() != 0 {
+		t.Error("expected Commit to empty the batch")
+	}
+}
+
+func TestKnowledgeBatch_AllOrNothing(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	_ = store.Add("g0", "greetings", nil)
+
+	err := store.Batch().
+		Add("g1", "greetings", nil).
+		Add("g0", "greetings", nil).
+		Update("missing", nil).
+		Add("", "greetings", nil).
+		Delete("g0").
+		Commit()
+	if err == nil {
+		t.Fatal("expected the batch to fail")
+	}
+	for _, want := range []string{`"g0" already exists`, `"missing" not found`, "empty id"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %s, got %v", want, err)
+		}
+	}
+	if _, ok := store.Get("g1"); ok {
+		t.Error("expected no change to be applied when one fails")
+	}
+	if _, ok := store.Get("g0"); !ok || len(store.History("g0")) != 1 {
+		t.Error("expected g0 untouched")
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Knowledge snapshots
+// ─────────────────────────────────────────────
+
+func TestKnowledge_Snapshot(t *testing.T) {
+	clock := illygen.NewManualClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := illygen.NewKnowledgeStore().Clock(clock).DomainTTL("greetings", time.Hour)
+	_ = store.Add("g1", "greetings", map[string]any{"response": "Hi"})
+
+	snap := store.Snapshot()
+	_ = store.Update("g1", map[string]any{"response": "Hello"})
+	_ = store.Add("g2", "greetings", nil)
+	clock.Advance(2 * time.Hour)
+
+	units := snap.Domain("greetings")
+	if len(units) != 1 || units[0].Fact("response") != "Hi" {
+		t.Errorf("expected the snapshot to keep only the first g1, got %v", units)
+	}
+	if store.Size() != 0 {
+		t.Error("expected the store's units to have expired")
+	}
+	if len(snap.History("g1")) != 1 {
+		t.Error("expected the snapshot's history to stop at the snapshot")
+	}
+	if err := snap.Delete("g1"); err == nil {
+		t.Error("expected a snapshot to be read-only")
+	}
+}
+
+func TestEngine_KnowledgeSnapshot(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	_ = store.Add("g1", "greetings", map[string]any{"response": "Hi"})
+
+	flow := illygen.NewFlow().
+		Add(illygen.NewNode("write", func(ctx illygen.Context) illygen.Result {
+			// Another writer changes the store mid-run.
+			_ = store.Update("g1", map[string]any{"response": "Hello"})
+			_ = store.Add("g2", "greetings", nil)
+			if err := illygen.Knowledge(ctx).Delete("g1"); err == nil {
+				t.Error("expected the run's knowledge to be read-only")
+			}
+			return illygen.Result{Next: "read"}
+		})).
+		Add(illygen.NewNode("read", func(ctx illygen.Context) illygen.Result {
+			units := illygen.Knowledge(ctx).Domain("greetings")
+			return illygen.Result{Value: fmt.Sprint(len(units), units[0].Fact("response"))}
+		}))
+
+	result, err := illygen.NewEngine(store).Run(flow, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Value != "1Hi" {
+		t.Errorf("expected the run to see the store as it started, got %v", result.Value)
+	}
+	if u, _ := store.Get("g1"); u.Fact("response") != "Hello" {
+		t.Error("expected the write to reach the store")
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Knowledge watches
+// ─────────────────────────────────────────────
+
+func TestKnowledge_Watch(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	w := store.Watch("d")
+	all := store.Watch("")
+
+	_ = store.As("alice").Add("g1", "d", map[string]any{"response": "Hi"})
+	_ = store.Add("m1", "math", nil)
+	_ = store.Update("g1", map[string]any{"response": "Hello"})
+	store.Reinforce(consultingRun(t, store), -1)
+	_ = store.Delete("g1")
+	w.Stop()
+	w.Stop()
+
+	var events []illygen.KnowledgeEvent
+	for e := range w.Events() {
+		events = append(events, e)
+	}
+	kinds := []illygen.VersionKind{illygen.VersionAdded, illygen.VersionUpdated, illygen.VersionReweighted, illygen.VersionDeleted}
+	if len(events) != len(kinds) {
+		t.Fatalf("expected %d events for the domain, got %+v", len(kinds), events)
+	}
+	for i, kind := range kinds {
+		if e := events[i]; e.Kind != kind || e.ID != "g1" || e.Version != i+1 {
+			t.Errorf("event %d: expected %s of g1 version %d, got %+v", i, kind, i+1, e)
+		}
+	}
+	if e := events[0]; e.Before != nil || e.After.Fact("response") != "Hi" || e.Author != "alice" {
+		t.Errorf("expected an add with no before, got %+v", e)
+	}
+	if e := events[1]; e.Before.Fact("response") != "Hi" || e.After.Fact("response") != "Hello" {
+		t.Errorf("expected the update's before and after, got %+v", e)
+	}
+	if e := events[2]; e.After.Weight >= 1 || e.Before.Weight != 1 {
+		t.Errorf("expected the reweight's before and after, got %+v", e)
+	}
+	if e := events[3]; e.After != nil || e.Before == nil {
+		t.Errorf("expected a delete with no after, got %+v", e)
+	}
+
+	if n := len(all.Events()); n != 5 {
+		t.Errorf("expected a watch on every domain to see 5 events, got %d", n)
+	}
+	all.Stop()
+}
+
+func TestKnowledge_WatchOverflow(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	w := store.Watch("d", illygen.WatchOptions{Buffer: 2})
+	defer w.Stop()
+
+	for i := 0; i < 5; i++ {
+		_ = store.Add(fmt.Sprint("k", i), "d", nil)
+	}
+	<-w.Events()
+	<-w.Events()
+	_ = store.Add("k5", "d", nil)
+	e := <-w.Events()
+	if e.ID != "k5" || e.Missed != 3 {
+		t.Errorf("expected k5 after 3 missed events, got %s with %d missed", e.ID, e.Missed)
+	}
+	if n := w.Missed(); n != 0 {
+		t.Errorf("expected the delivered event to have reported the misses, got %d", n)
+	}
+}
+
+func TestKnowledge_WatchOverflowThenQuiet(t *testing.T) {
+	store := illygen.NewKnowledgeStore()
+	w := store.Watch("d", illygen.WatchOptions{Buffer: 2})
+
+	for i := 0; i < 5; i++ {
+		_ = store.Add(fmt.Sprint("k", i), "d", nil)
+	}
+	<-w.Events()
+	<-w.Events()
+
+	// No further change arrives to report the overflow; Missed does.
+	if n := w.Missed(); n != 3 {
+		t.Errorf("expected 3 missed events, got %d", n)
+	}
+	if n := w.Missed(); n != 0 {
+		t.Errorf("expected Missed to reset once reported, got %d", n)
+	}
+
+	_ = store.Add("k5", "d", nil)
+	_ = store.Add("k6", "d", nil)
+	_ = store.Add("k7", "d", nil)
+	w.Stop()
+	if n := w.Missed(); n != 1 {
+		t.Errorf("expected Missed to report drops after Stop, got %d", n)
+	}
+	if e, ok := <-w.Events(); !ok || e.ID != "k5" || e.Missed != 0 {
+		t.Errorf("expected the buffered k5 to survive Stop, got %+v (ok=%v)", e, ok)
+	}
+}
+
+func TestKnowledge_WatchSweep(t *testing.T) {
+	clock := illygen.NewManualClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := illygen.NewKnowledgeStore().Clock(clock).DomainTTL("d", time.Minute)
+	_ = store.Add("k1", "d", nil)
+	w := store.Watch("d")
+	defer w.Stop()
+
+	clock.Advance(time.Hour)
+	store.Sweep()
+	if e := <-w.Events(); e.Kind != illygen.VersionExpired || e.ID != "k1" || e.Version != 2 || e.After != nil {
+		t.Errorf("expected an expiry to arrive as an expired version, got %+v", e)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Fact schemas
+// ─────────────────────────────────────────────
+
+func factStore() *illygen.KnowledgeStore {
+	return illygen.NewKnowledgeStore().Schema("facts", illygen.FactSchema{
+		"response": illygen.FactOf[string](),
+		"topic":    illygen.FactOf[string]().OneOf("node", "flow"),
+		"keywords": illygen.FactOf[[]string]().Optional(),
+		"score":    illygen.FactOf[float64]().Between(0, 1).Optional(),
+	})
+}
+
+func TestKnowledge_Schema(t *testing.T) {
+	store := factStore()
+	if err := store.Add("ok", "facts", map[string]any{"response": "Hi", "topic": "node", "score": 1, "extra": true}); err != nil {
+		t.Fatalf("expected conforming facts to be accepted, got %v", err)
+	}
+	if err := store.Add("free", "other", nil); err != nil {
+		t.Errorf("expected domains without a schema to accept anything, got %v", err)
+	}
+
+	err := store.Add("bad", "facts", map[string]any{"topic": "math", "keywords": "a", "score": 2.5})
+	if err == nil {
+		t.Fatal("expected broken facts to be rejected")
+	}
+	var fe *illygen.FactError
+	if !errors.As(err, &fe) || fe.ID != "bad" || fe.Key != "keywords" {
+		t.Errorf("expected a FactError for the first key, got %v", err)
+	}
+	for _, want := range []string{`"keywords" is a string, want []string`, `"response" is missing`, `"score" is 2.5, want 0 to 1`, `"topic" is math, want one of [node flow]`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %s, got %v", want, err)
+		}
+	}
+	if _, ok := store.Get("bad"); ok {
+		t.Error("expected the rejected unit not to be stored")
+	}
+
+	if err := store.Update("ok", map[string]any{"response": "Hi"}); err == nil {
+		t.Error("expected Update to enforce the schema")
+	}
+	if err := store.Batch().Add("b1", "facts", map[string]any{"topic": "flow"}).Commit(); err == nil {
+		t.Error("expected batches to enforce the schema")
+	}
+	if err := store.Schema("facts", nil).Update("ok", nil); err != nil {
+		t.Errorf("expected removing the schema to lift it, got %v", err)
+	}
+}
+
+func TestKnowledge_SchemaDecodedJSON(t *testing.T) {
+	store := illygen.NewKnowledgeStore().Schema("facts", illygen.FactSchema{
+		"keywords": illygen.FactOf[[]string](),
+		"level":    illygen.FactOf[int]().OneOf(1, 2),
+	})
+
+	// Facts as encoding/json decodes them: []any lists and float64 numbers.
+	if err := store.Add("json", "facts", map[string]any{"keywords": []any{"hi", "hello"}, "level": float64(1)}); err != nil {
+		t.Fatalf("expected facts decoded from JSON to be accepted, got %v", err)
+	}
+	if err := store.Add("mixed", "facts", map[string]any{"keywords": []any{"hi", 1}, "level": 2}); err == nil {
+		t.Error("expected a []any holding a non-string to be rejected")
+	}
+	if err := store.Add("other", "facts", map[string]any{"keywords": []string{}, "level": 3.0}); err == nil {
+		t.Error("expected a number outside OneOf to be rejected")
+	}
+}
+
+func TestKnowledgeUnit_TypedFacts(t *testing.T) {
+	u := &illygen.KnowledgeUnit{ID: "u", Facts: map[string]any{
+		"response": "Hi",
+		"keywords": []string{"hi", "hello"},
+		"decoded":  []any{"a", "b"},
+		"mixed":    []any{"a", 1},
+		"score":    3,
+	}}
+	if s, err := u.FactString("response"); err != nil || s != "Hi" {
+		t.Errorf("FactString: got %q, %v", s, err)
+	}
+	if kws, err := u.FactStrings("keywords"); err != nil || len(kws) != 2 {
+		t.Errorf("FactStrings: got %v, %v", kws, err)
+	}
+	if kws, err := u.FactStrings("decoded"); err != nil || kws[1] != "b" {
+		t.Errorf("FactStrings on []any: got %v, %v", kws, err)
+	}
+	if f, err := u.FactFloat("score"); err != nil || f != 3 {
+		t.Errorf("FactFloat: got %v, %v", f, err)
+	}
+
+	var fe *illygen.FactError
+	if _, err := u.FactString("score"); !errors.As(err, &fe) || fe.Problem != "is a int, want string" {
+		t.Errorf("expected a type mismatch, got %v", err)
+	}
+	if _, err := u.FactStrings("mixed"); err == nil {
+		t.Error("expected a mismatch for a list holding a non-string")
+	}
+	if _, err := u.FactFloat("missing"); !errors.As(err, &fe) || fe.Problem != "is missing" {
+		t.Errorf("expected a missing fact, got %v", err)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Knowledge history retention
+// ─────────────────────────────────────────────
+
+func TestKnowledge_RetainVersions(t *testing.T) {
+	store := illygen.NewKnowledgeStore().Retain(illygen.Retention{Versions: 3})
+	_ = store.Add("k1", "d", nil)
+	for i := 0; i < 10; i++ {
+		store.Reinforce(consultingRun(t, store), -0.5)
+	}
+
+	history := store.History("k1")
+	if len(history) != 3 {
+		t.Fatalf("expected reinforcement to keep only 3 versions, got %d", len(history))
+	}
+	if history[0].Version != 9 || history[2].Version != 11 {
+		t.Errorf("expected the latest versions 9 to 11, got %d to %d", history[0].Version, history[2].Version)
+	}
+	if err := store.Revert("k1", 2); err == nil {
+		t.Error("expected Revert to fail for a version no longer kept")
+	}
+	if err := store.Revert("k1", 9); err != nil {
+		t.Errorf("expected Revert to a kept version to succeed, got %v", err)
+	}
+	if v := store.History("k1")[2].Version; v != 12 {
+		t.Errorf("expected numbering to run on after trimming, got %d", v)
+	}
+}
+
+func TestKnowledge_RetainMaxAge(t *testing.T) {
+	clock := illygen.NewManualClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := illygen.NewKnowledgeStore().Clock(clock).
+		Retain(illygen.Retention{Versions: -1, MaxAge: time.Hour})
+	_ = store.Add("k1", "d", nil)
+	_ = store.Add("gone", "d", nil)
+	_ = store.Update("k1", map[string]any{"v": 2})
+	_ = store.Delete("gone")
+
+	clock.Advance(2 * time.Hour)
+	if dropped := store.Compact(); dropped != 3 {
+		t.Errorf("expected 3 versions dropped, got %d", dropped)
+	}
+	if h := store.History("k1"); len(h) != 1 || h[0].Version != 2 {
+		t.Errorf("expected a unit's latest version to be kept whatever its age, got %+v", h)
+	}
+	if h := store.History("gone"); h != nil {
+		t.Errorf("expected an old deleted unit's history to be dropped, got %+v", h)
+	}
+}
+
+func TestKnowledge_RetainSweptUnits(t *testing.T) {
+	clock := illygen.NewManualClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := illygen.NewKnowledgeStore().Clock(clock).
+		Retain(illygen.Retention{MaxAge: time.Hour}).
+		DomainTTL("d", time.Minute)
+	for i := 0; i < 5; i++ {
+		_ = store.Add(fmt.Sprint("u", i), "d", nil)
+	}
+
+	clock.Advance(time.Hour)
+	if removed := store.Sweep(); removed != 5 {
+		t.Fatalf("expected 5 units swept, got %d", removed)
+	}
+	if h := store.History("u0"); len(h) != 2 || h[1].Kind != illygen.VersionExpired || h[1].Unit != nil {
+		t.Errorf("expected the sweep to be recorded as an expired version, got %+v", h)
+	}
+
+	clock.Advance(48 * time.Hour)
+	if dropped := store.Compact(); dropped != 10 {
+		t.Errorf("expected the swept units' 10 versions dropped, got %d", dropped)
+	}
+	if h := store.History("u0"); h != nil {
+		t.Errorf("expected a swept unit's history to be dropped, got %+v", h)
+	}
+}
+
+func TestEngine_RetainKeepsRunSnapshot(t *testing.T) {
+	store := illygen.NewKnowledgeStore().Retain(illygen.Retention{Versions: 1})
+	_ = store.Add("g1", "greetings", map[string]any{"response": "Hi"})
+
+	flow := illygen.NewFlow().
+		Add(illygen.NewNode("write", func(ctx illygen.Context) illygen.Result {
+			for i := 0; i < 5; i++ {
+				_ = store.Update("g1", map[string]any{"response": fmt.Sprint("v", i)})
+			}
+			return illygen.Result{Next: "read"}
+		})).
+		Add(illygen.NewNode("read", func(ctx illygen.Context) illygen.Result {
+			u, ok := illygen.Knowledge(ctx).Get("g1")
+			if !ok {
+				return illygen.Result{Value: "missing"}
+			}
+			return illygen.Result{Value: u.Fact("response")}
+		}))
+
+	result, err := illygen.NewEngine(store).Run(flow, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Value != "Hi" {
+		t.Errorf("expected the run's snapshot to keep its version, got %v", result.Value)
+	}
+	store.Compact()
+	if h := store.History("g1"); len(h) != 1 || h[0].Unit.Fact("response") != "v4" {
+		t.Errorf("expected history trimmed once the run ended, got %+v", h)
+	}
+}
+
+// ─────────────────────────────────────────────
+//  Benchmarks
+// ─────────────────────────────────────────────
+
+// benchContext builds a Context of n keys, half of them nested JSON-style values.
+func benchContext(n int) illygen.Context {
+	ctx := illygen.Context{}
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			ctx[fmt.Sprint("k", i)] = i
+		} else {
+			ctx[fmt.Sprint("k", i)] = map[string]any{"tags": []any{"a", "b"}, "score": 0.5}
+		}
+	}
+	return ctx
+}
+
+func benchFlow() *illygen.Flow {
+	step := func(next string) illygen.NodeFunc {
+		return func(ctx illygen.Context) illygen.Result {
+			ctx.Set("last", next)
+			return illygen.Result{Next: next, Confidence: 1}
+		}
+	}
+	return illygen.NewFlow().
+		Add(illygen.NewNode("a", step("b"))).
+		Add(illygen.NewNode("b", step("c"))).
+		Add(illygen.NewNode("c", step("")))
+}
+
+func benchmarkRun(b *testing.B, engine *illygen.Engine, keys int) {
+	flow, ctx := benchFlow(), benchContext(keys)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := engine.Run(flow, ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEngine_Run(b *testing.B) {
+	for _, keys := range []int{10, 1000} {
+		b.Run(fmt.Sprint("keys=", keys), func(b *testing.B) {
+			benchmarkRun(b, illygen.NewEngine(), keys)
+		})
+	}
+}
+
+func BenchmarkEngine_Isolate(b *testing.B) {
+	for _, keys := range []int{10, 1000} {
+		b.Run(fmt.Sprint("keys=", keys), func(b *testing.B) {
+			benchmarkRun(b, illygen.NewEngine().Isolate(true), keys)
+		})
+	}
+}
+
+func BenchmarkEngine_NodeTimeout(b *testing.B) {
+	for _, keys := range []int{10, 1000} {
+		b.Run(fmt.Sprint("keys=", keys), func(b *testing.B) {
+			benchmarkRun(b, illygen.NewEngine().Limits(illygen.Limits{NodeTimeout: time.Second}), keys)
+		})
+	}
+}
@@ -8,10 +8,13 @@ import (
 )
 
 // Edge is a directed weighted connection between two nodes.
+// Pulls and Reward accumulate feedback for routes that followed this edge.
 type Edge struct {
 	From   string
 	To     string
 	Weight float64
+	Pulls  int
+	Reward float64 // sum of rewards over all pulls
 }
 
 // Graph is a directed weighted graph of node connections.
@@ -40,17 +43,68 @@ func (g *Graph) Add(from, to string, weight float64) error {
 	return nil
 }
 
-// From returns all edges outgoing from a node, sorted by weight descending.
+// From returns copies of all edges outgoing from a node, sorted by weight descending.
+// The copies are safe to read while feedback is being recorded.
 func (g *Graph) From(id string) []*Edge {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
 	edges := make([]*Edge, len(g.edges[id]))
-	copy(edges, g.edges[id])
+	for i, e := range g.edges[id] {
+		c := *e
+		edges[i] = &c
+	}
 	sortEdges(edges)
 	return edges
 }
 
+// All returns copies of every edge in the graph, in no particular order.
+func (g *Graph) All() []*Edge {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var edges []*Edge
+	for _, out := range g.edges {
+		for _, e := range out {
+			c := *e
+			edges = append(edges, &c)
+		}
+	}
+	return edges
+}
+
+// Reward records one pull of the edge from → to with the given reward.
+// Returns false if the edge does not exist.
+func (g *Graph) Reward(from, to string, reward float64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, e := range g.edges[from] {
+		if e.To == to {
+			e.Pulls++
+			e.Reward += reward
+			return true
+		}
+	}
+	return false
+}
+
+// SetStats overwrites the feedback statistics of the edge from → to.
+// Returns false if the edge does not exist.
+func (g *Graph) SetStats(from, to string, pulls int, reward float64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, e := range g.edges[from] {
+		if e.To == to {
+			e.Pulls = pulls
+			e.Reward = reward
+			return true
+		}
+	}
+	return false
+}
+
 // Has reports whether a node ID has any outgoing edges.
 func (g *Graph) Has(id string) bool {
 	g.mu.RLock()
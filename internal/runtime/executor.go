@@ -4,40 +4,116 @@ package runtime
 
 import (
 	"fmt"
+	"time"
 )
 
-// maxVisits is the maximum number of times a single node can be visited
-// in one flow execution before the engine declares a cycle and returns an error.
+// DefaultMaxVisits is the default maximum number of times a single node can
+// be visited in one flow execution before the engine declares a cycle and
+// returns an error, used when Limits leaves MaxVisits zero.
 // This guards against infinite loops caused by circular Next routing.
-const maxVisits = 50
+const DefaultMaxVisits = 50
+
+// Limits bounds a single execution. Zero values mean "no limit",
+// except MaxVisits, which defaults to DefaultMaxVisits.
+type Limits struct {
+	MaxVisits   int
+	MaxSteps    int
+	Timeout     time.Duration
+	NodeTimeout time.Duration
+	AllowCycles bool
+}
+
+// Options configures a single execution.
+type Options struct {
+	Limits Limits
+
+	// Prepare, if set, is called before each node runs, from the goroutine
+	// that called Execute. The executor may run on another goroutine, and
+	// be abandoned there if it times out, so per-node state it reads should
+	// be set up here.
+	Prepare func(nodeID string)
+
+	// OnStep, if set, is called after each step completes, in order,
+	// from the goroutine that called Execute.
+	OnStep func(Step)
+
+	// Visits and Taken carry the visit counts and step count of a
+	// suspended execution being resumed, so limits span both.
+	Visits map[string]int
+	Taken  int
+}
+
+// LimitKind identifies which limit a LimitError hit.
+type LimitKind int
+
+const (
+	LimitVisits LimitKind = iota
+	LimitSteps
+	LimitTimeout
+	LimitNodeTimeout
+)
+
+// LimitError is returned by Execute when an execution exceeds its Limits.
+// NodeID is the node being run (or about to be run) when the limit hit.
+// Count carries the visit or step limit, Duration the time limit.
+type LimitError struct {
+	Kind     LimitKind
+	NodeID   string
+	Count    int
+	Duration time.Duration
+}
+
+func (e *LimitError) Error() string {
+	switch e.Kind {
+	case LimitVisits:
+		return fmt.Sprintf("illygen/runtime: node %q visited %d times — possible cycle detected", e.NodeID, e.Count)
+	case LimitSteps:
+		return fmt.Sprintf("illygen/runtime: step limit of %d reached at node %q", e.Count, e.NodeID)
+	case LimitTimeout:
+		return fmt.Sprintf("illygen/runtime: run exceeded %s at node %q", e.Duration, e.NodeID)
+	default:
+		return fmt.Sprintf("illygen/runtime: node %q exceeded %s", e.NodeID, e.Duration)
+	}
+}
 
 // Step records what happened at a single node during execution.
+// Route records how Next was chosen (e.g. "next", "link", "end").
+// Duration is how long the executor took for this node.
+// Suspend pauses the execution after this step; Execute returns with
+// Done false and the trace's Final.Next is where to resume.
+// Data is carried through untouched for the executor's caller.
 type Step struct {
 	NodeID     string
 	Value      any
 	Confidence float64
 	Next       string
+	Route      string
+	Suspend    bool
+	Duration   time.Duration
+	Data       any
 }
 
-// ExecutionTrace is the complete record of a flow execution.
-// It is used by the engine to return results and, in future versions,
-// by the learning logic to adjust weights.
 // ExecutionTrace is the complete record of a flow execution.
 // Steps holds every node visited in order.
 // Final holds the last step — its Value and Confidence are returned to the caller.
-// In future versions, the learning logic will read the trace to adjust weights.
+// Done is false if the execution was suspended; Visits then holds the
+// visit counts to resume with.
 type ExecutionTrace struct {
-	Steps []Step
-	Final Step
-	Done  bool
+	Steps  []Step
+	Final  Step
+	Done   bool
+	Visits map[string]int
 }
 
 // NodeExecutor is a function that runs a node — the engine calls this
 // to decouple the executor from the illygen package types.
-type NodeExecutor func(nodeID string) (value any, confidence float64, next string, err error)
+// The returned Step does not need NodeID set; Execute fills it in.
+type NodeExecutor func(nodeID string) (Step, error)
 
 // Execute runs the flow from the entry node, walking the graph
-// until a node returns an empty Next or no outgoing edges exist.
+// until a node returns an empty Next or no outgoing edges exist,
+// or until a step asks to suspend.
+// It returns a *LimitError as soon as any of the limits is exceeded.
 //
 // This is the core algorithm:
 //
@@ -47,38 +123,124 @@ type NodeExecutor func(nodeID string) (value any, confidence float64, next strin
 //	  choose next node (from result.Next or highest-weight edge)
 //	  move to next node
 //	Stop when no next node
-func Execute(entry string, executor NodeExecutor) (*ExecutionTrace, error) {
+func Execute(entry string, executor NodeExecutor, opts Options) (*ExecutionTrace, error) {
+	limits := opts.Limits
+	if limits.MaxVisits <= 0 {
+		limits.MaxVisits = DefaultMaxVisits
+	}
+
 	trace := &ExecutionTrace{}
 	current := entry
 
-	visited := make(map[string]int)
+	visited := make(map[string]int, len(opts.Visits))
+	for id, n := range opts.Visits {
+		visited[id] = n
+	}
+
+	var deadline time.Time
+	if limits.Timeout > 0 {
+		deadline = time.Now().Add(limits.Timeout)
+	}
 
 	for current != "" {
 		visited[current]++
-		if visited[current] > maxVisits {
-			return nil, fmt.Errorf(
-				"illygen/runtime: node %q visited %d times — possible cycle detected",
-				current, visited[current],
-			)
+		if !limits.AllowCycles && visited[current] > limits.MaxVisits {
+			return nil, &LimitError{Kind: LimitVisits, NodeID: current, Count: visited[current]}
+		}
+		if limits.MaxSteps > 0 && opts.Taken+len(trace.Steps) >= limits.MaxSteps {
+			return nil, &LimitError{Kind: LimitSteps, NodeID: current, Count: limits.MaxSteps}
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return nil, &LimitError{Kind: LimitTimeout, NodeID: current, Duration: limits.Timeout}
 		}
 
-		value, confidence, next, err := executor(current)
+		if opts.Prepare != nil {
+			opts.Prepare(current)
+		}
+		start := time.Now()
+		step, err := run(current, executor, limits, deadline)
 		if err != nil {
+			if _, ok := err.(*LimitError); ok {
+				return nil, err
+			}
 			return nil, fmt.Errorf("illygen/runtime: node %q failed: %w", current, err)
 		}
 
-		step := Step{
-			NodeID:     current,
-			Value:      value,
-			Confidence: confidence,
-			Next:       next,
-		}
+		step.NodeID = current
+		step.Duration = time.Since(start)
 		trace.Steps = append(trace.Steps, step)
 		trace.Final = step
+		if opts.OnStep != nil {
+			opts.OnStep(step)
+		}
 
-		current = next
+		current = step.Next
+		if step.Suspend && current != "" {
+			trace.Visits = visited
+			return trace, nil
+		}
 	}
 
 	trace.Done = true
 	return trace, nil
 }
+
+// Call runs a single node as Execute would: under limits.NodeTimeout and
+// the given deadline, if not zero. It returns a *LimitError if either is
+// exceeded. The visit and step limits are left to the caller.
+func Call(nodeID string, executor NodeExecutor, limits Limits, deadline time.Time) (Step, error) {
+	return run(nodeID, executor, limits, deadline)
+}
+
+// run calls the executor for one node, enforcing the node timeout and
+// the run deadline. Without either, the executor is called directly.
+//
+// A node that times out cannot be stopped — its goroutine is abandoned
+// and its eventual result discarded. A node that panics in time panics
+// again on the caller's goroutine, as it would without limits; a panic
+// after the timeout is recovered and discarded with the result.
+func run(nodeID string, executor NodeExecutor, limits Limits, deadline time.Time) (Step, error) {
+	if limits.NodeTimeout <= 0 && deadline.IsZero() {
+		return executor(nodeID)
+	}
+
+	wait, kind, limit := limits.NodeTimeout, LimitNodeTimeout, limits.NodeTimeout
+	if !deadline.IsZero() {
+		if remaining := time.Until(deadline); wait <= 0 || remaining < wait {
+			wait, kind, limit = remaining, LimitTimeout, limits.Timeout
+		}
+	}
+
+	type outcome struct {
+		step     Step
+		err      error
+		panicked bool
+		panic    any
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		var o outcome
+		defer func() {
+			// A panic must not escape this goroutine: it would kill the
+			// process instead of reaching the caller.
+			if r := recover(); r != nil {
+				o = outcome{panicked: true, panic: r}
+			}
+			done <- o
+		}()
+		o.step, o.err = executor(nodeID)
+	}()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case o := <-done:
+		if o.panicked {
+			panic(o.panic)
+		}
+		return o.step, o.err
+	case <-timer.C:
+		return Step{}, &LimitError{Kind: kind, NodeID: nodeID, Duration: limit}
+	}
+}
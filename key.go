@@ -0,0 +1,197 @@
+package illygen
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Key is a typed Context key. Declaring keys once and sharing them between
+// the nodes that write and read a value turns a typo or a type mismatch
+// into a compile error instead of a silent zero value.
+//
+//	var Intent = illygen.NewKey[string]("intent")
+//
+//	// in one node
+//	Intent.Set(ctx, "greeting")
+//
+//	// in another
+//	if intent, ok := Intent.Get(ctx); ok { ... }
+type Key[T any] struct {
+	name string
+}
+
+// NewKey creates a typed key for the given Context key name.
+// The name must be non-empty.
+func NewKey[T any](name string) Key[T] {
+	if name == "" {
+		panic("illygen: NewKey called with empty name")
+	}
+	return Key[T]{name: name}
+}
+
+// Name returns the Context key the Key reads and writes.
+func (k Key[T]) Name() string {
+	return k.name
+}
+
+// Get returns the value stored under the key.
+// ok is false if the key doesn't exist or holds a value of another type.
+// A nil stored under a key of interface type (such as Key[any] or
+// Key[error]) is found, as T's zero value.
+// Numbers stored with a different numeric type (e.g. an int64 read through
+// a Key[int]) are converted when the conversion is lossless.
+func (k Key[T]) Get(ctx Context) (T, bool) {
+	var zero T
+	v, ok := ctx[k.name]
+	if !ok {
+		return zero, false
+	}
+	if v == nil {
+		return zero, reflect.TypeOf((*T)(nil)).Elem().Kind() == reflect.Interface
+	}
+	if t, ok := v.(T); ok {
+		return t, true
+	}
+	if c, ok := convertNumber(v, reflect.TypeOf(zero)); ok {
+		return c.Interface().(T), true
+	}
+	return zero, false
+}
+
+// Set stores value under the key.
+func (k Key[T]) Set(ctx Context, value T) {
+	ctx[k.name] = value
+}
+
+// MustGet is like Get but panics with a descriptive message if the key
+// is missing or holds a value of another type. Use it for values a node
+// cannot work without.
+func (k Key[T]) MustGet(ctx Context) T {
+	t, ok := k.Get(ctx)
+	if !ok {
+		v, exists := ctx[k.name]
+		if !exists {
+			panic(fmt.Sprintf("illygen: context key %q is not set", k.name))
+		}
+		panic(fmt.Sprintf("illygen: context key %q holds %T, not %T", k.name, v, t))
+	}
+	return t
+}
+
+// ToInt converts any Go integer or float to an int.
+// ok is false if v is not a number, has a fractional part,
+// or does not fit in an int.
+func ToInt(v any) (int, bool) {
+	i, ok := toInt64(v)
+	if !ok || i < math.MinInt || i > math.MaxInt {
+		return 0, false
+	}
+	return int(i), true
+}
+
+// ToFloat converts any Go integer or float to a float64.
+// ok is false if v is not a number.
+func ToFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// toInt64 converts any Go integer, or any float without a fractional part,
+// to an int64.
+func toInt64(v any) (int64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(u), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(f), true
+	}
+	return 0, false
+}
+
+// sameNumber reports whether f, converted from the number v, still holds
+// exactly v's value.
+func sameNumber(v any, f float64) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return f >= math.MinInt64 && f < math.MaxInt64 && int64(f) == rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return f >= 0 && f < math.MaxUint64 && uint64(f) == rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return f == rv.Float() || math.IsNaN(f) && math.IsNaN(rv.Float())
+	}
+	return false
+}
+
+// convertNumber converts a number to the numeric type to, if it can be
+// done without losing information.
+func convertNumber(v any, to reflect.Type) (reflect.Value, bool) {
+	if to == nil {
+		return reflect.Value{}, false
+	}
+	switch to.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f, ok := ToFloat(v)
+		if !ok {
+			return reflect.Value{}, false
+		}
+		out := reflect.New(to).Elem()
+		if out.OverflowFloat(f) {
+			return reflect.Value{}, false
+		}
+		out.SetFloat(f)
+		if !sameNumber(v, out.Float()) {
+			return reflect.Value{}, false // e.g. an int64 above 2^53
+		}
+		return out, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := toInt64(v)
+		if !ok {
+			return reflect.Value{}, false
+		}
+		out := reflect.New(to).Elem()
+		if out.OverflowInt(i) {
+			return reflect.Value{}, false
+		}
+		out.SetInt(i)
+		return out, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := toInt64(v)
+		if !ok || i < 0 {
+			return reflect.Value{}, false
+		}
+		out := reflect.New(to).Elem()
+		if out.OverflowUint(uint64(i)) {
+			return reflect.Value{}, false
+		}
+		out.SetUint(uint64(i))
+		return out, true
+	}
+	return reflect.Value{}, false
+}
@@ -10,9 +10,9 @@ import (
 // It is lightweight — similar in concept to a tensor in AI, but built around
 // structured facts rather than numerical matrices.
 //
-// Units are created via KnowledgeStore.Add.
+// Units are created via KnowledgeStore.Add or KnowledgeStore.Train.
 // Training produces units with high initial Weight.
-// Exploring (v0.3+) will refine weights over time.
+// Exploring refines weights over time through KnowledgeStore.Reinforce.
 type KnowledgeUnit struct {
 	// ID uniquely identifies this unit within the store.
 	ID string
@@ -30,8 +30,29 @@ type KnowledgeUnit struct {
 	// Defaults to 1.0 on creation.
 	Weight float64
 
-	// Updated records the last time this unit was modified.
+	// Updated records the last time this unit was added, or its facts or
+	// TTL changed. TTLs and decay count from it.
 	Updated time.Time
+
+	// Reweighted records the last time KnowledgeStore.Reinforce changed
+	// Weight. Reinforcement does not touch Updated, so it neither renews
+	// the unit's TTL nor restarts its decay.
+	Reweighted time.Time
+
+	// Version counts the changes made to this unit, starting at 1 when it
+	// is added. See KnowledgeStore.History.
+	Version int
+
+	// Trained marks a unit added with KnowledgeStore.Train. Reinforcement
+	// never lowers its Weight below TrainedWeight.
+	Trained       bool
+	TrainedWeight float64
+
+	// TTL, if set, expires the unit TTL after Updated, overriding its
+	// domain's TTL. See KnowledgeStore.SetTTL and KnowledgeStore.DomainTTL.
+	TTL time.Duration
+
+	decayed time.Time // when Weight last had decay applied, by Sweep or Reinforce
 }
 
 // Fact returns a single fact value by key. Returns nil if not found.
@@ -41,9 +62,57 @@ func (u *KnowledgeUnit) Fact(key string) any {
 
 // KnowledgeStore holds all KnowledgeUnits for an Illygen engine.
 // Nodes query it by domain to retrieve relevant knowledge during execution.
+//
+// The store nodes get from Knowledge(ctx) is a read-only Snapshot of the
+// engine's store, taken when the run started, that also audits every query
+// a node makes, for Step.Knowledge and Step.Accesses.
 type KnowledgeStore struct {
+	base *knowledgeBase
+
+	// audit, if set, is told about every query and the units it returned.
+	audit func(access KnowledgeAccess)
+
+	// author is recorded with every change made through this handle.
+	author string
+
+	// past makes the handle a read-only view of the store as it was at —
+	// and, if pinned, holding only the versions up to seq.
+	past   bool
+	at     time.Time
+	pinned bool
+	seq    uint64
+}
+
+// KnowledgeAccess records one query a node made through Knowledge(ctx).
+type KnowledgeAccess struct {
+	// Op is the query method: "get", "domain" or "find".
+	Op string
+
+	// Query is the unit ID (for get) or domain (for domain and find) asked for.
+	Query string
+
+	// Units lists the IDs of the units returned, in order. Empty if none were.
+	Units []string
+}
+
+// knowledgeBase is the data shared by a store and its views.
+type knowledgeBase struct {
 	mu    sync.RWMutex
 	units map[string]*KnowledgeUnit
+
+	// history holds the versions of every unit kept under retention,
+	// oldest first.
+	history   map[string][]KnowledgeVersion
+	seq       uint64         // of the latest version
+	retention Retention      // how much history to keep
+	pins      map[uint64]int // seqs of the snapshots runs in progress read, counted
+
+	clock     Clock
+	ttls      map[string]time.Duration // by domain
+	halfLives map[string]time.Duration // by domain
+	schemas   map[string]FactSchema    // by domain
+
+	watches map[*KnowledgeWatch]bool
 }
 
 // NewKnowledgeStore creates an empty KnowledgeStore.
@@ -53,72 +122,170 @@ type KnowledgeStore struct {
 //	store := illygen.NewKnowledgeStore()
 //	store.Add("k1", "greetings", map[string]any{"response": "Hi! I'm Illygen."})
 func NewKnowledgeStore() *KnowledgeStore {
-	return &KnowledgeStore{
-		units: make(map[string]*KnowledgeUnit),
+	return &KnowledgeStore{base: &knowledgeBase{
+		units:     make(map[string]*KnowledgeUnit),
+		history:   make(map[string][]KnowledgeVersion),
+		retention: Retention{}.withDefaults(),
+		pins:      make(map[uint64]int),
+		clock:     systemClock{},
+		ttls:      make(map[string]time.Duration),
+		halfLives: make(map[string]time.Duration),
+		schemas:   make(map[string]FactSchema),
+		watches:   make(map[*KnowledgeWatch]bool),
+	}}
+}
+
+// view returns a view of the store that reports every query to audit.
+func (s *KnowledgeStore) view(audit func(KnowledgeAccess)) *KnowledgeStore {
+	v := *s
+	v.audit = audit
+	return &v
+}
+
+// record reports a query and the units it returned to the view's audit, if any.
+func (s *KnowledgeStore) record(op, query string, units ...*KnowledgeUnit) {
+	if s.audit == nil {
+		return
+	}
+	access := KnowledgeAccess{Op: op, Query: query}
+	for _, u := range units {
+		access.Units = append(access.Units, u.ID)
 	}
+	s.audit(access)
 }
 
 // Add inserts a new KnowledgeUnit into the store.
-// Both id and domain must be non-empty strings.
+// Both id and domain must be non-empty strings, and facts must conform to
+// the domain's FactSchema, if it has one (see KnowledgeStore.Schema).
 // Returns an error if a unit with the same ID already exists.
 func (s *KnowledgeStore) Add(id, domain string, facts map[string]any) error {
-	if id == "" {
-		return fmt.Errorf("illygen: KnowledgeStore.Add called with empty id")
+	return s.add(&KnowledgeUnit{ID: id, Domain: domain, Facts: facts, Weight: 1.0})
+}
+
+// add validates and inserts a new unit, stamping its Updated time.
+func (s *KnowledgeStore) add(u *KnowledgeUnit) error {
+	if err := checkNewUnit(u); err != nil {
+		return err
 	}
-	if domain == "" {
-		return fmt.Errorf("illygen: KnowledgeStore.Add %q called with empty domain", id)
+
+	if err := s.writable(); err != nil {
+		return err
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
 
-	if _, exists := s.units[id]; exists {
-		return fmt.Errorf("illygen: knowledge unit %q already exists", id)
+	if _, exists := s.base.units[u.ID]; exists {
+		return fmt.Errorf("illygen: knowledge unit %q already exists", u.ID)
 	}
-	s.units[id] = &KnowledgeUnit{
-		ID:      id,
-		Domain:  domain,
-		Facts:   facts,
-		Weight:  1.0,
-		Updated: time.Now(),
+	if err := s.base.checkFacts(u); err != nil {
+		return err
 	}
+	u.Updated = s.base.clock.Now()
+	s.commit(u.ID, u, VersionAdded, u.Updated)
 	return nil
 }
 
-// Get retrieves a KnowledgeUnit by ID.
+// checkNewUnit validates a unit about to be added.
+func checkNewUnit(u *KnowledgeUnit) error {
+	if u.ID == "" {
+		return fmt.Errorf("illygen: KnowledgeStore.Add called with empty id")
+	}
+	if u.Domain == "" {
+		return fmt.Errorf("illygen: KnowledgeStore.Add %q called with empty domain", u.ID)
+	}
+	return nil
+}
+
+// Get retrieves a KnowledgeUnit by ID. Expired units are not found.
 func (s *KnowledgeStore) Get(id string) (*KnowledgeUnit, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	u, ok := s.units[id]
+	s.base.mu.RLock()
+	u, ok := s.stored(id)
+	if ok {
+		u, ok = s.base.live(u, s.now())
+	}
+	s.base.mu.RUnlock()
+	if ok {
+		s.record("get", id, u)
+	} else {
+		s.record("get", id)
+	}
 	return u, ok
 }
 
-// Domain returns all KnowledgeUnits in a given domain, sorted by weight descending.
+// Domain returns all KnowledgeUnits in a given domain, sorted by weight
+// descending, then by ID.
 // This is how nodes query knowledge — by domain, not by ID.
 func (s *KnowledgeStore) Domain(domain string) []*KnowledgeUnit {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	result := s.domain(domain)
+	sortUnitsByWeight(result)
+	s.record("domain", domain, result...)
+	return result
+}
 
-	var result []*KnowledgeUnit
-	for _, u := range s.units {
-		if u.Domain == domain {
-			result = append(result, u)
+// Find returns the KnowledgeUnits in a domain for which match returns true,
+// sorted by weight descending. Prefer it to filtering Domain's result by
+// hand inside a node: only the matching units count as consulted in the
+// run's Trace, so explanations and feedback credit the knowledge actually used.
+//
+//	units := illygen.Knowledge(ctx).Find("greetings", func(u *illygen.KnowledgeUnit) bool {
+//	    return u.Fact("lang") == "en"
+//	})
+func (s *KnowledgeStore) Find(domain string, match func(u *KnowledgeUnit) bool) []*KnowledgeUnit {
+	result := s.domain(domain)
+
+	// match runs without the lock held, so it may query the store itself.
+	kept := result[:0]
+	for _, u := range result {
+		if match(u) {
+			kept = append(kept, u)
 		}
 	}
-	sortUnitsByWeight(result)
-	return result
+	sortUnitsByWeight(kept)
+	s.record("find", domain, kept...)
+	return kept
 }
 
-// Size returns the total number of units in the store.
+// Size returns the total number of units in the store, not counting
+// expired ones.
 func (s *KnowledgeStore) Size() int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return len(s.units)
+	s.base.mu.RLock()
+	defer s.base.mu.RUnlock()
+	now := s.now()
+	n := 0
+	s.each(func(u *KnowledgeUnit) {
+		if _, ok := s.base.live(u, now); ok {
+			n++
+		}
+	})
+	return n
 }
 
+// domain returns the live units of a domain, unsorted.
+func (s *KnowledgeStore) domain(domain string) []*KnowledgeUnit {
+	s.base.mu.RLock()
+	defer s.base.mu.RUnlock()
+	now := s.now()
+	var result []*KnowledgeUnit
+	s.each(func(u *KnowledgeUnit) {
+		if u.Domain != domain {
+			return
+		}
+		if u, ok := s.base.live(u, now); ok {
+			result = append(result, u)
+		}
+	})
+	return result
+}
+
+// sortUnitsByWeight sorts by weight descending, then by ID, so units of
+// equal weight come back in a stable order.
 func sortUnitsByWeight(units []*KnowledgeUnit) {
+	less := func(a, b *KnowledgeUnit) bool {
+		return a.Weight > b.Weight || a.Weight == b.Weight && a.ID < b.ID
+	}
 	for i := 1; i < len(units); i++ {
-		for j := i; j > 0 && units[j].Weight > units[j-1].Weight; j-- {
+		for j := i; j > 0 && less(units[j], units[j-1]); j-- {
 			units[j], units[j-1] = units[j-1], units[j]
 		}
 	}
@@ -0,0 +1,147 @@
+package illygen
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/leraniode/illygen/internal/runtime"
+)
+
+// Limits bounds every run of an Engine. Zero values mean "no limit",
+// except MaxVisits, which defaults to 50.
+//
+//	engine := illygen.NewEngine().Limits(illygen.Limits{
+//	    MaxSteps: 200,
+//	    Timeout:  time.Second,
+//	})
+type Limits struct {
+	// MaxVisits is how many times a single node may be visited in one run
+	// before the engine declares a cycle and returns a *CycleError.
+	MaxVisits int
+
+	// MaxSteps is the total number of node executions allowed in one run.
+	// Exceeding it returns a *StepLimitError.
+	MaxSteps int
+
+	// Timeout is the wall time allowed for one run.
+	// Exceeding it returns a *TimeoutError.
+	Timeout time.Duration
+
+	// NodeTimeout is the wall time allowed for a single node execution.
+	// Exceeding it returns a *NodeTimeoutError.
+	//
+	// A NodeFunc cannot be interrupted: a node that times out is not
+	// stopped, it keeps running in the background and its Result is
+	// discarded. Under a NodeTimeout or Timeout every node runs on a private
+	// copy of the Context, merged back only if the node finishes in time, so
+	// a late node's Context writes are lost rather than racing with the
+	// caller. Its memory writes and Random draws are not isolated: slow nodes
+	// should watch Done(ctx) and return once it is closed. The copy is
+	// shallow, so it costs one map copy per step, proportional to the number
+	// of Context keys, and nested values are still shared.
+	NodeTimeout time.Duration
+
+	// AllowCycles disables the MaxVisits cycle guard for flows that loop
+	// on purpose (e.g. refinement loops). Pair it with MaxSteps or Timeout
+	// so a loop that never converges is still stopped.
+	AllowCycles bool
+}
+
+// CycleError is returned when a node is visited more than Limits.MaxVisits
+// times in one run.
+type CycleError struct {
+	NodeID string
+	Visits int
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf(
+		"illygen: node %q visited %d times — possible cycle detected (raise Limits.MaxVisits or set Limits.AllowCycles)",
+		e.NodeID, e.Visits,
+	)
+}
+
+// StepLimitError is returned when a run exceeds Limits.MaxSteps.
+type StepLimitError struct {
+	NodeID string // the node that would have run next
+	Steps  int
+}
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("illygen: run reached the limit of %d steps before node %q", e.Steps, e.NodeID)
+}
+
+// TimeoutError is returned when a run exceeds Limits.Timeout.
+type TimeoutError struct {
+	NodeID  string // the node running when time ran out
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("illygen: run exceeded its %s timeout at node %q", e.Timeout, e.NodeID)
+}
+
+// NodeTimeoutError is returned when a single node exceeds Limits.NodeTimeout.
+type NodeTimeoutError struct {
+	NodeID  string
+	Timeout time.Duration
+}
+
+func (e *NodeTimeoutError) Error() string {
+	return fmt.Sprintf("illygen: node %q exceeded its %s timeout", e.NodeID, e.Timeout)
+}
+
+// Done returns a channel closed when the run a node belongs to is over —
+// including when the run has given up on the node for exceeding its
+// NodeTimeout or the run's Timeout. Slow nodes should select on it and
+// return early. Call it inside a NodeFunc; returns nil, which blocks
+// forever, outside of a run.
+//
+//	select {
+//	case res := <-lookup(query):
+//	    return illygen.Result{Value: res}
+//	case <-illygen.Done(ctx):
+//	    return illygen.Result{}
+//	}
+func Done(ctx Context) <-chan struct{} {
+	if s := ctx.run(); s != nil {
+		return s.done
+	}
+	return nil
+}
+
+// timed reports whether nodes may be abandoned for running out of time.
+func (l Limits) timed() bool {
+	return l.NodeTimeout > 0 || l.Timeout > 0
+}
+
+// runtimeLimits converts Limits into their internal runtime form.
+func (l Limits) runtimeLimits() runtime.Limits {
+	return runtime.Limits{
+		MaxVisits:   l.MaxVisits,
+		MaxSteps:    l.MaxSteps,
+		Timeout:     l.Timeout,
+		NodeTimeout: l.NodeTimeout,
+		AllowCycles: l.AllowCycles,
+	}
+}
+
+// limitError translates an internal runtime limit error into its public type.
+// Any other error is returned unchanged.
+func limitError(err error) error {
+	var le *runtime.LimitError
+	if !errors.As(err, &le) {
+		return err
+	}
+	switch le.Kind {
+	case runtime.LimitVisits:
+		return &CycleError{NodeID: le.NodeID, Visits: le.Count}
+	case runtime.LimitSteps:
+		return &StepLimitError{NodeID: le.NodeID, Steps: le.Count}
+	case runtime.LimitTimeout:
+		return &TimeoutError{NodeID: le.NodeID, Timeout: le.Duration}
+	default:
+		return &NodeTimeoutError{NodeID: le.NodeID, Timeout: le.Duration}
+	}
+}
@@ -0,0 +1,140 @@
+package illygen
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// LogOptions configures the structured logging set up by Engine.Logger.
+type LogOptions struct {
+	// Level is the level of run and step records (default slog.LevelInfo).
+	// Failed runs are always logged at slog.LevelError.
+	Level slog.Level
+
+	// Redact, if set, is called for every Context value before it is logged.
+	// Return the value to log in its place. See RedactKeys.
+	Redact func(key string, value any) any
+}
+
+// RedactKeys returns a LogOptions.Redact function that replaces the values
+// of the given Context keys with "[REDACTED]" and logs every other value as is.
+//
+//	engine.Logger(logger, illygen.LogOptions{Redact: illygen.RedactKeys("token", "email")})
+func RedactKeys(keys ...string) func(key string, value any) any {
+	secret := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		secret[k] = true
+	}
+	return func(key string, value any) any {
+		if secret[key] {
+			return "[REDACTED]"
+		}
+		return value
+	}
+}
+
+// Logger makes the engine emit structured records to logger:
+// one when a run starts (with its input Context), one per step (node ID,
+// confidence, chosen next node, routing reason and duration), one when a
+// run finishes, and an error record when a run fails.
+//
+// Every record carries a run_id attribute so concurrent runs can be told apart.
+// Logger is built on Hooks, so it can be combined with other hooks freely.
+// Returns the Engine for chaining.
+//
+//	engine := illygen.NewEngine().Logger(slog.Default())
+func (e *Engine) Logger(logger *slog.Logger, opts ...LogOptions) *Engine {
+	if logger == nil {
+		return e
+	}
+	var o LogOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	l := &runLogger{logger: logger, opts: o}
+	return e.Hooks(Hooks{
+		OnRunStart: l.runStart,
+		OnStep:     l.step,
+		OnError:    l.runError,
+		OnRunEnd:   l.runEnd,
+	})
+}
+
+// runLogger turns run lifecycle hooks into slog records.
+type runLogger struct {
+	logger *slog.Logger
+	opts   LogOptions
+}
+
+func (l *runLogger) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	l.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+func (l *runLogger) runStart(run *RunInfo) {
+	if !l.logger.Enabled(context.Background(), l.opts.Level) {
+		return
+	}
+	l.log(l.opts.Level, "illygen: run started",
+		slog.Uint64("run_id", run.ID),
+		l.contextAttr(run.Context),
+	)
+}
+
+func (l *runLogger) step(run *RunInfo, step Step) {
+	l.log(l.opts.Level, "illygen: step",
+		slog.Uint64("run_id", run.ID),
+		slog.String("node", step.NodeID),
+		slog.Float64("confidence", step.Confidence),
+		slog.String("next", step.Next),
+		slog.String("route", string(step.Route)),
+		slog.Duration("duration", step.Duration),
+	)
+}
+
+func (l *runLogger) runError(run *RunInfo, err error) {
+	l.log(slog.LevelError, "illygen: run failed",
+		slog.Uint64("run_id", run.ID),
+		slog.Duration("duration", time.Since(run.Start)),
+		slog.String("error", err.Error()),
+	)
+}
+
+func (l *runLogger) runEnd(run *RunInfo, trace *Trace, err error) {
+	if err != nil {
+		return // already logged by runError
+	}
+	l.log(l.opts.Level, "illygen: run finished",
+		slog.Uint64("run_id", run.ID),
+		slog.Int("steps", len(trace.Steps)),
+		slog.Float64("confidence", trace.Result.Confidence),
+		slog.Duration("duration", time.Since(run.Start)),
+	)
+}
+
+// contextAttr renders a Context as a sorted, redacted "context" group.
+// Internal keys injected by the engine are left out.
+func (l *runLogger) contextAttr(ctx Context) slog.Attr {
+	keys := make([]string, 0, len(ctx))
+	for k := range ctx {
+		if !internalKey(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	attrs := make([]any, 0, len(keys))
+	for _, k := range keys {
+		v := ctx[k]
+		if l.opts.Redact != nil {
+			v = l.opts.Redact(k, v)
+		}
+		attrs = append(attrs, slog.Any(k, v))
+	}
+	return slog.Group("context", attrs...)
+}
@@ -0,0 +1,302 @@
+package illygen
+
+import (
+	"slices"
+	"sync"
+)
+
+// Memory is a scoped key-value store that nodes reach from inside a NodeFunc.
+// Unlike the Context, memory is never seen by the caller of Run.
+// It is safe for concurrent use.
+//
+// Three scopes exist, each with its own lifetime:
+//
+//	NodeMemory(ctx)    one node, across its visits within a single run
+//	FlowMemory(ctx)    every node of a single run
+//	SessionMemory(ctx) every run of one Session, until Engine.EndSession
+type Memory struct {
+	mu   sync.RWMutex
+	data map[string]any
+}
+
+func newMemory() *Memory {
+	return &Memory{data: make(map[string]any)}
+}
+
+// Get retrieves a value by key. Returns nil if the key doesn't exist.
+func (m *Memory) Get(key string) any {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.data[key]
+}
+
+// Set stores a value under the given key.
+func (m *Memory) Set(key string, value any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = value
+}
+
+// Has reports whether a key exists in memory.
+func (m *Memory) Has(key string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.data[key]
+	return ok
+}
+
+// Delete removes a key from memory.
+func (m *Memory) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+}
+
+// Update atomically replaces the value under key with fn(old) and returns
+// the new value. old is nil if the key doesn't exist. Use it for
+// read-modify-write on SessionMemory, which concurrent runs may share.
+//
+//	visits := illygen.SessionMemory(ctx).Update("visits", func(old any) any {
+//	    n, _ := old.(int)
+//	    return n + 1
+//	})
+func (m *Memory) Update(key string, fn func(old any) any) any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v := fn(m.data[key])
+	m.data[key] = v
+	return v
+}
+
+// Keys returns every key in memory, sorted.
+func (m *Memory) Keys() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return sortedKeys(m.data)
+}
+
+// clone returns a shallow copy of the memory.
+func (m *Memory) clone() *Memory {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := newMemory()
+	for k, v := range m.data {
+		c.data[k] = v
+	}
+	return c
+}
+
+// NodeMemory returns the memory of the node currently running.
+// It persists across visits of that node within one run — useful for
+// retry counters and refinement loops — and is discarded when the run ends.
+// Call it inside a NodeFunc; returns nil outside of a run.
+//
+//	attempts := illygen.NodeMemory(ctx).Update("attempts", func(old any) any {
+//	    n, _ := old.(int)
+//	    return n + 1
+//	})
+func NodeMemory(ctx Context) *Memory {
+	if s := ctx.run(); s != nil {
+		return s.nodeMemory()
+	}
+	return nil
+}
+
+// FlowMemory returns the memory shared by every node of the current run.
+// It is discarded when the run ends and, unlike the Context, is never
+// returned to the caller. Call it inside a NodeFunc; returns nil outside
+// of a run.
+func FlowMemory(ctx Context) *Memory {
+	if s := ctx.run(); s != nil {
+		return s.flow
+	}
+	return nil
+}
+
+// SessionMemory returns the memory of the Session the current run belongs to.
+// It persists across runs of the same session until Engine.EndSession.
+// Returns nil if the run was not started through a Session.
+func SessionMemory(ctx Context) *Memory {
+	if s := ctx.run(); s != nil && s.session != nil {
+		return s.session.memory
+	}
+	return nil
+}
+
+// Session groups runs that share SessionMemory — typically one per user
+// or conversation. Get one with Engine.Session.
+type Session struct {
+	id     string
+	engine *Engine
+	memory *Memory
+}
+
+// Session returns the session with the given ID, creating it on first use.
+// The same *Session is returned for the same ID until EndSession is called.
+//
+//	session := engine.Session("user-42")
+//	result, err := session.Run(flow, illygen.Context{"text": text})
+func (e *Engine) Session(id string) *Session {
+	e.sessionsMu.Lock()
+	defer e.sessionsMu.Unlock()
+
+	s, ok := e.sessions[id]
+	if !ok {
+		s = &Session{id: id, engine: e, memory: newMemory()}
+		e.sessions[id] = s
+	}
+	return s
+}
+
+// EndSession discards a session and its memory. Runs already in progress
+// keep the memory they started with; the next Session(id) starts afresh.
+func (e *Engine) EndSession(id string) {
+	e.sessionsMu.Lock()
+	defer e.sessionsMu.Unlock()
+	delete(e.sessions, id)
+}
+
+// ID returns the session's identifier.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Memory returns the session's memory, the same Memory nodes reach
+// through SessionMemory(ctx).
+func (s *Session) Memory() *Memory {
+	return s.memory
+}
+
+// Run executes a flow within the session. See Engine.Run.
+func (s *Session) Run(flow *Flow, ctx Context) (Result, error) {
+	trace, err := s.RunTrace(flow, ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	return trace.Result, nil
+}
+
+// RunTrace executes a flow within the session. See Engine.RunTrace.
+func (s *Session) RunTrace(flow *Flow, ctx Context) (*Trace, error) {
+	return s.engine.runTrace(flow, ctx, runOptions{session: s})
+}
+
+// runKey is the reserved Context key the engine stores a run's state under,
+// so nodes can reach knowledge and memory from inside a NodeFunc.
+const runKey = "__illygen_run__"
+
+// runState is what the engine makes available to the nodes of one run.
+type runState struct {
+	knowledge *KnowledgeStore
+	session   *Session
+	flow      *Memory
+	entropy   *entropy
+
+	mu        sync.Mutex
+	node      string // node currently running
+	nodes     map[string]*Memory
+	consulted []string          // IDs of the knowledge units the node consulted
+	accesses  []KnowledgeAccess // the node's knowledge queries
+
+	release func()        // releases the run's knowledge snapshot, if any
+	done    chan struct{} // closed when the run is over; shared by forks
+	ended   sync.Once
+}
+
+func newRunState(knowledge *KnowledgeStore, session *Session, entropy *entropy) *runState {
+	s := &runState{
+		session: session,
+		flow:    newMemory(),
+		entropy: entropy,
+		nodes:   make(map[string]*Memory),
+		done:    make(chan struct{}),
+	}
+	if knowledge != nil {
+		s.knowledge = knowledge.view(s.audit)
+	}
+	return s
+}
+
+// end marks the run as over, closing Done, and releases what the run held
+// on to. Only the run's own state is ended, never a fork.
+func (s *runState) end() {
+	s.ended.Do(func() {
+		close(s.done)
+		if s.release != nil {
+			s.release()
+		}
+	})
+}
+
+// enter records that nodeID is about to run.
+func (s *runState) enter(nodeID string) {
+	s.entropy.enter()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.node = nodeID
+	s.consulted, s.accesses = nil, nil
+}
+
+// audit records a knowledge query made by the running node.
+func (s *runState) audit(access KnowledgeAccess) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accesses = append(s.accesses, access)
+	for _, id := range access.Units {
+		if !slices.Contains(s.consulted, id) {
+			s.consulted = append(s.consulted, id)
+		}
+	}
+}
+
+// takeAudit returns the IDs of the units the running node consulted and
+// the queries it made, and starts afresh.
+func (s *runState) takeAudit() ([]string, []KnowledgeAccess) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, accesses := s.consulted, s.accesses
+	s.consulted, s.accesses = nil, nil
+	return ids, accesses
+}
+
+func (s *runState) nodeMemory() *Memory {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.nodes[s.node]
+	if !ok {
+		m = newMemory()
+		s.nodes[s.node] = m
+	}
+	return m
+}
+
+// fork copies the run-scoped memory for a branch that must not see
+// the writes of its siblings. Session memory stays shared.
+func (s *runState) fork() *runState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := newRunState(s.knowledge, s.session, s.entropy)
+	f.done = s.done
+	f.flow = s.flow.clone()
+	f.node = s.node
+	for id, m := range s.nodes {
+		f.nodes[id] = m.clone()
+	}
+	return f
+}
+
+// run returns the state of the run the context belongs to, or nil.
+func (c Context) run() *runState {
+	s, _ := c[runKey].(*runState)
+	return s
+}
+
+// fork returns a deep copy of the context with its own copy of
+// the run-scoped state, for branches of a beam search.
+func (c Context) fork() Context {
+	f := c.deepClone()
+	if s := c.run(); s != nil {
+		f[runKey] = s.fork()
+	}
+	return f
+}
@@ -0,0 +1,400 @@
+package illygen
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics receives measurements from every run of an Engine.
+// Flows are identified by their Name (see Flow.Named).
+// Implementations must be safe for concurrent use.
+//
+// NewMemoryMetrics provides an in-memory implementation.
+type Metrics interface {
+	// ObserveStep is called after each node runs.
+	ObserveStep(flow string, step Step)
+
+	// ObserveRun is called once per run, after the last step.
+	// trace is nil when err is not. If the run failed at a node, err is or
+	// wraps a typed error naming it, such as a *NodeTimeoutError or a
+	// *RouteError; find it with errors.As.
+	ObserveRun(flow string, trace *Trace, duration time.Duration, err error)
+}
+
+// Metrics makes the engine report every step and run to m.
+// It is built on Hooks, so it can be combined with other hooks freely.
+// Returns the Engine for chaining.
+//
+//	metrics := illygen.NewMemoryMetrics()
+//	engine := illygen.NewEngine().Metrics(metrics)
+//	// ... later
+//	metrics.WritePrometheus(os.Stdout)
+func (e *Engine) Metrics(m Metrics) *Engine {
+	if m == nil {
+		return e
+	}
+	return e.Hooks(Hooks{
+		OnStep: func(run *RunInfo, step Step) {
+			m.ObserveStep(run.Flow.name, step)
+		},
+		OnRunEnd: func(run *RunInfo, trace *Trace, err error) {
+			m.ObserveRun(run.Flow.name, trace, time.Since(run.Start), err)
+		},
+	})
+}
+
+// Histogram buckets (upper bounds) used by MemoryMetrics.
+var (
+	latencyBuckets    = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+	confidenceBuckets = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1.0}
+)
+
+// Histogram is a snapshot of a distribution of observed values.
+type Histogram struct {
+	// Bounds holds the upper bound of each bucket, ascending.
+	Bounds []float64
+
+	// Counts holds how many observations fell at or below each bound
+	// (cumulative, as in Prometheus). Observations above the last bound
+	// are only counted in Count.
+	Counts []uint64
+
+	Count uint64
+	Sum   float64
+}
+
+// Mean returns the average observed value, or 0 if nothing was observed.
+func (h Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.Count)
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds))}
+}
+
+func (h *Histogram) observe(v float64) {
+	for i, b := range h.Bounds {
+		if v <= b {
+			h.Counts[i]++
+		}
+	}
+	h.Count++
+	h.Sum += v
+}
+
+func (h *Histogram) snapshot() Histogram {
+	return Histogram{
+		Bounds: h.Bounds,
+		Counts: append([]uint64(nil), h.Counts...),
+		Count:  h.Count,
+		Sum:    h.Sum,
+	}
+}
+
+// NodeStats is a snapshot of the metrics recorded for one node of one flow.
+type NodeStats struct {
+	// Visits counts how many times the node ran.
+	Visits uint64
+
+	// Fallbacks counts visits after which the node left Result.Next empty
+	// and the engine fell back to the flow graph (RouteLink).
+	Fallbacks uint64
+
+	// Errors counts runs that failed at the node: while it ran (a timeout
+	// or a route to a missing node), or as it was about to run again (a
+	// cycle or step limit). Failed executions are not Visits.
+	Errors uint64
+
+	// Latency is the distribution of step durations, in seconds.
+	Latency Histogram
+
+	// Confidence is the distribution of the Confidence the node returned.
+	Confidence Histogram
+}
+
+// FallbackRate returns Fallbacks / Visits, or 0 if the node never ran.
+func (s NodeStats) FallbackRate() float64 {
+	if s.Visits == 0 {
+		return 0
+	}
+	return float64(s.Fallbacks) / float64(s.Visits)
+}
+
+// ErrorRate returns Errors / (Visits + Errors) — the share of the node's
+// executions that failed — or 0 if the node never ran.
+func (s NodeStats) ErrorRate() float64 {
+	if s.Visits+s.Errors == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Visits+s.Errors)
+}
+
+// FlowStats is a snapshot of the metrics recorded for one flow.
+type FlowStats struct {
+	Runs   uint64
+	Errors uint64
+
+	// Latency is the distribution of run durations, in seconds.
+	Latency Histogram
+}
+
+// ErrorRate returns Errors / Runs, or 0 if the flow never ran.
+func (s FlowStats) ErrorRate() float64 {
+	if s.Runs == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Runs)
+}
+
+// MemoryMetrics is an in-memory Metrics implementation holding counters
+// and histograms keyed by flow name and node ID.
+// It is safe for concurrent use.
+type MemoryMetrics struct {
+	mu    sync.Mutex
+	flows map[string]*flowMetrics
+}
+
+type flowMetrics struct {
+	runs    uint64
+	errors  uint64
+	latency *Histogram
+	nodes   map[string]*nodeMetrics
+}
+
+type nodeMetrics struct {
+	visits     uint64
+	fallbacks  uint64
+	errors     uint64
+	latency    *Histogram
+	confidence *Histogram
+}
+
+// NewMemoryMetrics creates an empty MemoryMetrics.
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{flows: make(map[string]*flowMetrics)}
+}
+
+// ObserveStep implements Metrics.
+func (m *MemoryMetrics) ObserveStep(flow string, step Step) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.flow(flow).node(step.NodeID)
+	n.visits++
+	if step.Route == RouteLink {
+		n.fallbacks++
+	}
+	n.latency.observe(step.Duration.Seconds())
+	n.confidence.observe(step.Confidence)
+}
+
+// ObserveRun implements Metrics.
+func (m *MemoryMetrics) ObserveRun(flow string, _ *Trace, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := m.flow(flow)
+	f.runs++
+	if err != nil {
+		f.errors++
+		if id := errorNode(err); id != "" {
+			f.node(id).errors++
+		}
+	}
+	f.latency.observe(duration.Seconds())
+}
+
+// Flow returns a snapshot of the metrics recorded for a flow.
+func (m *MemoryMetrics) Flow(flow string) FlowStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.flows[flow]
+	if !ok {
+		return FlowStats{Latency: newHistogram(latencyBuckets).snapshot()}
+	}
+	return FlowStats{Runs: f.runs, Errors: f.errors, Latency: f.latency.snapshot()}
+}
+
+// Node returns a snapshot of the metrics recorded for a node of a flow.
+func (m *MemoryMetrics) Node(flow, nodeID string) NodeStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n *nodeMetrics
+	if f, ok := m.flows[flow]; ok {
+		n = f.nodes[nodeID]
+	}
+	if n == nil {
+		n = newNodeMetrics()
+	}
+	return NodeStats{
+		Visits:     n.visits,
+		Fallbacks:  n.fallbacks,
+		Errors:     n.errors,
+		Latency:    n.latency.snapshot(),
+		Confidence: n.confidence.snapshot(),
+	}
+}
+
+// errorNode returns the node a run failed at, from its error, or "".
+func errorNode(err error) string {
+	var (
+		route     *RouteError
+		timeout   *NodeTimeoutError
+		deadline  *TimeoutError
+		cycle     *CycleError
+		steps     *StepLimitError
+		schemaErr *SchemaError
+	)
+	switch {
+	case errors.As(err, &route):
+		return route.NodeID
+	case errors.As(err, &timeout):
+		return timeout.NodeID
+	case errors.As(err, &deadline):
+		return deadline.NodeID
+	case errors.As(err, &cycle):
+		return cycle.NodeID
+	case errors.As(err, &steps):
+		return steps.NodeID
+	case errors.As(err, &schemaErr):
+		return schemaErr.NodeID
+	}
+	return ""
+}
+
+// flow returns the metrics of a flow, creating them if needed. m.mu must be held.
+func (m *MemoryMetrics) flow(name string) *flowMetrics {
+	f, ok := m.flows[name]
+	if !ok {
+		f = &flowMetrics{latency: newHistogram(latencyBuckets), nodes: make(map[string]*nodeMetrics)}
+		m.flows[name] = f
+	}
+	return f
+}
+
+func (f *flowMetrics) node(id string) *nodeMetrics {
+	n, ok := f.nodes[id]
+	if !ok {
+		n = newNodeMetrics()
+		f.nodes[id] = n
+	}
+	return n
+}
+
+func newNodeMetrics() *nodeMetrics {
+	return &nodeMetrics{
+		latency:    newHistogram(latencyBuckets),
+		confidence: newHistogram(confidenceBuckets),
+	}
+}
+
+// WritePrometheus writes every metric in the Prometheus text exposition
+// format, sorted by flow and node so the output is stable.
+// Serve it from an HTTP handler or write it to a file for a textfile collector.
+func (m *MemoryMetrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	flows := sortedKeys(m.flows)
+
+	header(bw, "illygen_runs_total", "counter", "Flow runs.")
+	for _, name := range flows {
+		fmt.Fprintf(bw, "illygen_runs_total%s %d\n", labels("flow", name), m.flows[name].runs)
+	}
+	header(bw, "illygen_run_errors_total", "counter", "Flow runs that returned an error.")
+	for _, name := range flows {
+		fmt.Fprintf(bw, "illygen_run_errors_total%s %d\n", labels("flow", name), m.flows[name].errors)
+	}
+	header(bw, "illygen_run_duration_seconds", "histogram", "Wall time of flow runs.")
+	for _, name := range flows {
+		writeHistogram(bw, "illygen_run_duration_seconds", m.flows[name].latency, "flow", name)
+	}
+
+	type nodeKey struct{ flow, node string }
+	var nodes []nodeKey
+	for _, name := range flows {
+		for _, id := range sortedKeys(m.flows[name].nodes) {
+			nodes = append(nodes, nodeKey{name, id})
+		}
+	}
+	get := func(k nodeKey) *nodeMetrics { return m.flows[k.flow].nodes[k.node] }
+
+	header(bw, "illygen_node_visits_total", "counter", "Node executions.")
+	for _, k := range nodes {
+		fmt.Fprintf(bw, "illygen_node_visits_total%s %d\n", labels("flow", k.flow, "node", k.node), get(k).visits)
+	}
+	header(bw, "illygen_node_fallbacks_total", "counter", "Node executions routed by the flow graph instead of Result.Next.")
+	for _, k := range nodes {
+		fmt.Fprintf(bw, "illygen_node_fallbacks_total%s %d\n", labels("flow", k.flow, "node", k.node), get(k).fallbacks)
+	}
+	header(bw, "illygen_node_errors_total", "counter", "Runs that failed at the node.")
+	for _, k := range nodes {
+		fmt.Fprintf(bw, "illygen_node_errors_total%s %d\n", labels("flow", k.flow, "node", k.node), get(k).errors)
+	}
+	header(bw, "illygen_node_duration_seconds", "histogram", "Wall time of node executions.")
+	for _, k := range nodes {
+		writeHistogram(bw, "illygen_node_duration_seconds", get(k).latency, "flow", k.flow, "node", k.node)
+	}
+	header(bw, "illygen_node_confidence", "histogram", "Confidence returned by nodes.")
+	for _, k := range nodes {
+		writeHistogram(bw, "illygen_node_confidence", get(k).confidence, "flow", k.flow, "node", k.node)
+	}
+
+	return bw.Flush()
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeHistogram(w io.Writer, name string, h *Histogram, kv ...string) {
+	kv = kv[:len(kv):len(kv)] // appending "le" must not clobber the caller's slice
+	for i, b := range h.Bounds {
+		le := strconv.FormatFloat(b, 'g', -1, 64)
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels(append(kv, "le", le)...), h.Counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels(append(kv, "le", "+Inf")...), h.Count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels(kv...), strconv.FormatFloat(h.Sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels(kv...), h.Count)
+}
+
+// labels renders key/value pairs as a Prometheus label set.
+func labels(kv ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(kv[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(kv[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -16,6 +16,10 @@ type NodeFunc func(ctx Context) Result
 type Node struct {
 	id string
 	fn NodeFunc
+
+	// Context contract, declared with Reads and Writes.
+	reads  []Field
+	writes []Field
 }
 
 // NewNode creates a new Node with the given ID and logic function.
@@ -41,9 +45,3 @@ func NewNode(id string, fn NodeFunc) *Node {
 func (n *Node) ID() string {
 	return n.id
 }
-
-// execute runs the node's logic against the given context.
-// Called internally by the engine — not by users.
-func (n *Node) execute(ctx Context) Result {
-	return n.fn(ctx)
-}
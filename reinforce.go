@@ -0,0 +1,128 @@
+package illygen
+
+import "math"
+
+// Reinforcement bounds how KnowledgeStore.Reinforce moves unit weights.
+// The zero value uses the defaults.
+type Reinforcement struct {
+	// Rate is the learning rate, the fraction of the distance to Ceiling
+	// (or Floor) a reward of 1 (or -1) covers. Default 0.1, at most 1.
+	Rate float64
+
+	// Floor and Ceiling bound the weights reinforcement can produce.
+	// Defaults 0.0 and 1.0. Trained units never fall below their trained
+	// weight, whatever the Floor.
+	Floor   float64
+	Ceiling float64
+}
+
+func (r Reinforcement) withDefaults() Reinforcement {
+	if r.Rate <= 0 {
+		r.Rate = 0.1
+	}
+	r.Rate = math.Min(r.Rate, 1)
+	if r.Ceiling <= 0 {
+		r.Ceiling = 1.0
+	}
+	return r
+}
+
+// Train inserts a KnowledgeUnit the developer vouches for, with the given
+// Weight (clamped to 0.0–1.0). Trained units are what Exploring builds on:
+// Reinforce may raise their weight but never lowers it below the weight
+// they were trained with — see the Learning section of DESIGN.md.
+// Returns an error if a unit with the same ID already exists.
+//
+//	store.Train("g1", "greetings", map[string]any{"response": "Hi!"}, 0.9)
+func (s *KnowledgeStore) Train(id, domain string, facts map[string]any, weight float64) error {
+	return s.add(trainedUnit(id, domain, facts, weight))
+}
+
+func trainedUnit(id, domain string, facts map[string]any, weight float64) *KnowledgeUnit {
+	weight = clamp01(weight)
+	return &KnowledgeUnit{
+		ID:            id,
+		Domain:        domain,
+		Facts:         facts,
+		Weight:        weight,
+		Trained:       true,
+		TrainedWeight: weight,
+	}
+}
+
+// Reinforce nudges the weight of every KnowledgeUnit consulted during the
+// traced run (see Trace.Knowledge) according to how the run went: a
+// positive reward boosts them towards the Ceiling, a negative one penalizes
+// them towards the Floor, each in proportion to the Rate. Rewards are
+// clamped to -1.0–1.0.
+//
+// Weights only ever move by small, bounded steps, and trained units are
+// never demoted below their trained weight. Reinforcement sets Reweighted,
+// not Updated: it does not renew a unit's TTL, and decay carries on from
+// the reinforced weight. Units deleted or expired since the run are
+// skipped. Returns the units whose weight changed, each as a new
+// VersionReweighted version.
+//
+//	trace, _ := engine.RunTrace(flow, ctx)
+//	store.Reinforce(trace, 1.0)  // the answer was right
+//	store.Reinforce(trace, -1.0) // the answer was wrong
+func (s *KnowledgeStore) Reinforce(trace *Trace, reward float64, opts ...Reinforcement) []*KnowledgeUnit {
+	if trace == nil || s.past {
+		return nil
+	}
+	var o Reinforcement
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	o = o.withDefaults()
+	reward = math.Max(-1, math.Min(1, reward))
+
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+
+	var changed []*KnowledgeUnit
+	now := s.base.clock.Now()
+	for _, id := range trace.Knowledge() {
+		stored, ok := s.base.units[id]
+		if !ok {
+			continue
+		}
+		// Reinforce the weight queries see, decay included.
+		old, ok := s.base.live(stored, now)
+		if !ok {
+			continue
+		}
+		w := o.reinforce(old, reward)
+		if w == old.Weight {
+			continue
+		}
+		// Units are replaced rather than modified, so nodes still holding
+		// the old unit never see it change under them.
+		// The new weight already includes the decay up to now, so decay
+		// carries on from now. Updated, and with it the TTL, is untouched.
+		u := *old
+		u.Weight = w
+		u.Reweighted = now
+		u.decayed = now
+		s.commit(id, &u, VersionReweighted, now)
+		changed = append(changed, &u)
+	}
+	return changed
+}
+
+// reinforce returns the unit's new weight after a reward. Weights approach
+// the Ceiling or Floor but never cross it, and weights already past one
+// are left alone.
+func (r Reinforcement) reinforce(u *KnowledgeUnit, reward float64) float64 {
+	w := u.Weight
+	switch {
+	case reward > 0 && w < r.Ceiling:
+		w += r.Rate * reward * (r.Ceiling - w)
+	case reward < 0 && w > r.Floor:
+		w += r.Rate * reward * (w - r.Floor)
+	}
+	if u.Trained && w < u.TrainedWeight {
+		w = u.TrainedWeight
+	}
+	return w
+}
@@ -0,0 +1,366 @@
+package illygen
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Recording is everything needed to replay a run exactly: its input
+// Context, what every node returned, and the random numbers and times the
+// run consumed. Get one from Trace.Recording or RunInfo.Recording after
+// enabling Engine.RecordRuns, store it with Save, and replay it with
+// Engine.Replay.
+type Recording struct {
+	// Flow is the name of the flow that was run.
+	Flow string
+
+	// Input is a copy of the input Context, without internal keys.
+	Input Context
+
+	// Steps holds every step of the run, in order.
+	Steps []RecordedStep
+
+	// Result is what the run returned. Err is the error message if it failed.
+	Result Result
+	Err    string
+}
+
+// RecordedStep is a Step together with the random numbers and times
+// consumed while it ran — by its node through Random and Now, and by the
+// routing Strategy.
+type RecordedStep struct {
+	Step
+	Draws []float64
+	Times []time.Time
+}
+
+// RecordRuns controls whether every run is recorded for Engine.Replay.
+// The Recording is available as Trace.Recording and, for hooks, as
+// RunInfo.Recording — complete by the time OnRunEnd is called, even when
+// the run fails. Runs started by Resume are not recorded.
+//
+// For a replay to be exact, nodes must take time and randomness from
+// Now(ctx) and Random(ctx) rather than from the time and math/rand packages.
+// Returns the Engine for chaining.
+//
+//	engine := illygen.NewEngine().RecordRuns(true).Hooks(illygen.Hooks{
+//	    OnRunEnd: func(run *illygen.RunInfo, _ *illygen.Trace, err error) {
+//	        if err != nil {
+//	            run.Recording.Save(file)
+//	        }
+//	    },
+//	})
+func (e *Engine) RecordRuns(on bool) *Engine {
+	e.recordRuns = on
+	return e
+}
+
+// Save writes the recording to w. The encoding is encoding/gob, as for
+// Trace.Checkpoint: Context and Step values of types other than Go's basic
+// types, []any, map[string]any, Context and Result must be registered with
+// gob.Register.
+func (r *Recording) Save(w io.Writer) error {
+	if err := gob.NewEncoder(w).Encode(r); err != nil {
+		return fmt.Errorf("illygen: encoding recording: %w", err)
+	}
+	return nil
+}
+
+// LoadRecording reads a recording written by Recording.Save.
+func LoadRecording(r io.Reader) (*Recording, error) {
+	var rec Recording
+	if err := gob.NewDecoder(r).Decode(&rec); err != nil {
+		return nil, fmt.Errorf("illygen: decoding recording: %w", err)
+	}
+	return &rec, nil
+}
+
+// ReplayResult is the outcome of Engine.Replay.
+type ReplayResult struct {
+	// Trace is the replayed run, nil if it failed. Err is its error.
+	Trace *Trace
+	Err   error
+
+	// Divergence is the first step where the replay behaved differently
+	// from the recording, nil if it behaved identically.
+	Divergence *Divergence
+}
+
+// Divergence describes the first step where a replay departed from its
+// recording.
+type Divergence struct {
+	// Step is the index of the step that differs.
+	Step int
+
+	// Want is the recorded step and Got the replayed one. Either is nil
+	// when that run had no such step.
+	Want *Step
+	Got  *Step
+
+	// Reason describes the difference.
+	Reason string
+}
+
+func (d *Divergence) String() string {
+	return fmt.Sprintf("illygen: replay diverged at step %d: %s", d.Step, d.Reason)
+}
+
+// Replay runs flow again from the recording's input, feeding nodes and the
+// routing Strategy the random numbers and times the recorded run consumed,
+// and compares every step with the recording. The flow may be the one that
+// was recorded or a modified version of it — the result reports the first
+// step whose node, value, confidence or route differs, or that consumed
+// randomness or time differently.
+//
+// Hooks, Middleware and Limits apply as for any run. A nil recording is
+// not run: the result's Err says so.
+//
+//	rec, _ := illygen.LoadRecording(file)
+//	if d := engine.Replay(flow, rec).Divergence; d != nil {
+//	    fmt.Println(d)
+//	}
+func (e *Engine) Replay(flow *Flow, rec *Recording) *ReplayResult {
+	if rec == nil {
+		return &ReplayResult{Err: fmt.Errorf("illygen: Replay called with nil recording")}
+	}
+	r := &replayRun{recording: rec}
+	trace, err := e.runTrace(flow, rec.Input.clone(), runOptions{replay: r})
+
+	d := rec.compare(r.steps, err)
+	if ed := r.entropy.divergence(); ed != nil && (d == nil || ed.Step <= d.Step) {
+		d = ed
+		if d.Step < len(rec.Steps) {
+			d.Want = &rec.Steps[d.Step].Step
+		}
+		if d.Step < len(r.steps) {
+			d.Got = &r.steps[d.Step]
+		}
+	}
+	return &ReplayResult{Trace: trace, Err: err, Divergence: d}
+}
+
+// replayRun is a replay in progress. The engine fills in the steps the
+// replay took and the entropy it drew from.
+type replayRun struct {
+	recording *Recording
+	steps     []Step
+	entropy   *entropy
+}
+
+// finish fills in the steps and outcome of the recorded run.
+func (r *Recording) finish(steps []Step, consumed []RecordedStep, trace *Trace, err error) {
+	r.Steps = make([]RecordedStep, len(steps))
+	for i, s := range steps {
+		r.Steps[i].Step = s
+		if i < len(consumed) {
+			r.Steps[i].Draws = consumed[i].Draws
+			r.Steps[i].Times = consumed[i].Times
+		}
+	}
+	if trace != nil {
+		r.Result = trace.Result
+	}
+	if err != nil {
+		r.Err = err.Error()
+	}
+}
+
+// compare returns the first difference between the recording and a replay
+// that took steps and returned err.
+func (r *Recording) compare(steps []Step, err error) *Divergence {
+	for i := 0; i < len(r.Steps) || i < len(steps); i++ {
+		var want, got *Step
+		if i < len(r.Steps) {
+			want = &r.Steps[i].Step
+		}
+		if i < len(steps) {
+			got = &steps[i]
+		}
+		if reason := diffSteps(want, got); reason != "" {
+			return &Divergence{Step: i, Want: want, Got: got, Reason: reason}
+		}
+	}
+
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+	}
+	if errMsg != r.Err {
+		return &Divergence{Step: len(steps), Reason: fmt.Sprintf("run error %q, recorded %q", errMsg, r.Err)}
+	}
+	return nil
+}
+
+func diffSteps(want, got *Step) string {
+	switch {
+	case got == nil:
+		return fmt.Sprintf("replay stopped before node %q", want.NodeID)
+	case want == nil:
+		return fmt.Sprintf("replay ran extra node %q", got.NodeID)
+	case got.NodeID != want.NodeID:
+		return fmt.Sprintf("consulted node %q, recorded %q", got.NodeID, want.NodeID)
+	case !reflect.DeepEqual(got.Value, want.Value):
+		return fmt.Sprintf("node %q returned value %v, recorded %v", got.NodeID, got.Value, want.Value)
+	case got.Confidence != want.Confidence:
+		return fmt.Sprintf("node %q returned confidence %v, recorded %v", got.NodeID, got.Confidence, want.Confidence)
+	case got.Next != want.Next || got.Route != want.Route:
+		return fmt.Sprintf("node %q routed to %q (%s), recorded %q (%s)",
+			got.NodeID, got.Next, got.Route, want.Next, want.Route)
+	}
+	return ""
+}
+
+// Now returns the current time as seen by the run. Nodes should use it
+// instead of time.Now so recorded runs replay exactly — see Engine.RecordRuns.
+// Returns time.Now() outside of a run.
+func Now(ctx Context) time.Time {
+	if s := ctx.run(); s != nil {
+		return s.entropy.now()
+	}
+	return time.Now()
+}
+
+// Random returns the run's source of random numbers, the same one the
+// routing Strategy draws from. Nodes should use it instead of math/rand so
+// recorded runs replay exactly — see Engine.RecordRuns.
+// Call it inside a NodeFunc; returns nil outside of a run.
+func Random(ctx Context) Rand {
+	if s := ctx.run(); s != nil {
+		return s.entropy
+	}
+	return nil
+}
+
+// entropy is a run's source of randomness and time. It passes the engine's
+// random source and the wall clock through, recording what was consumed
+// step by step, or hands back a recording's values when replaying.
+type entropy struct {
+	mu   sync.Mutex
+	live Rand
+	step int // index of the step consuming entropy; -1 before the first
+
+	record bool
+	steps  []RecordedStep // recorded draws and times, by step
+
+	replaying bool
+	replay    []RecordedStep
+	drawn     int // draws and times handed out for the current step
+	timed     int
+	diverged  *Divergence
+}
+
+func newEntropy(live Rand) *entropy {
+	return &entropy{live: live, step: -1}
+}
+
+// enter moves on to the next step.
+func (en *entropy) enter() {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	if en.replaying {
+		en.checkUsed()
+	}
+	en.step++
+	en.drawn, en.timed = 0, 0
+	if en.record {
+		en.steps = append(en.steps, RecordedStep{})
+	}
+}
+
+// Float64 implements Rand.
+func (en *entropy) Float64() float64 {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	if want := en.replayStep(); want != nil {
+		if en.drawn < len(want.Draws) {
+			en.drawn++
+			return want.Draws[en.drawn-1]
+		}
+		en.diverge("consumed more random numbers than recorded")
+	}
+	f := en.live.Float64()
+	if en.record && en.step >= 0 {
+		en.steps[en.step].Draws = append(en.steps[en.step].Draws, f)
+	}
+	return f
+}
+
+func (en *entropy) now() time.Time {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	if want := en.replayStep(); want != nil {
+		if en.timed < len(want.Times) {
+			en.timed++
+			return want.Times[en.timed-1]
+		}
+		en.diverge("read the time more often than recorded")
+	}
+	t := time.Now()
+	if en.record && en.step >= 0 {
+		en.steps[en.step].Times = append(en.steps[en.step].Times, t)
+	}
+	return t
+}
+
+// replayStep returns the recorded step being replayed, or nil.
+func (en *entropy) replayStep() *RecordedStep {
+	if !en.replaying || en.step < 0 || en.step >= len(en.replay) {
+		return nil
+	}
+	return &en.replay[en.step]
+}
+
+// checkUsed flags a step that consumed less than was recorded.
+func (en *entropy) checkUsed() {
+	want := en.replayStep()
+	if want == nil {
+		return
+	}
+	if en.drawn < len(want.Draws) {
+		en.diverge("consumed fewer random numbers than recorded")
+	} else if en.timed < len(want.Times) {
+		en.diverge("read the time less often than recorded")
+	}
+}
+
+// diverge records the first entropy divergence, at the current step.
+func (en *entropy) diverge(reason string) {
+	if en.diverged == nil {
+		en.diverged = &Divergence{Step: en.step, Reason: reason}
+	}
+}
+
+// recorded returns the draws and times consumed by each step.
+func (en *entropy) recorded() []RecordedStep {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	return en.steps
+}
+
+// divergence returns the first entropy divergence of a replay, or nil.
+func (en *entropy) divergence() *Divergence {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	if en.diverged == nil && en.replaying {
+		en.checkUsed()
+	}
+	return en.diverged
+}
+
+// replaying makes the entropy hand back the draws and times of steps.
+func (en *entropy) replayFrom(steps []RecordedStep) {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	en.replaying, en.replay = true, steps
+}
+
+// startRecording makes the entropy record what each step consumes.
+func (en *entropy) startRecording() {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	en.record = true
+}
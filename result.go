@@ -4,7 +4,8 @@ package illygen
 //
 // The engine uses Result to decide what happens next:
 //   - If Next is set, the engine consults that node next.
-//   - If Next is empty, the engine follows the highest-weight Link from the flow graph.
+//   - If Next is empty, the engine's routing Strategy picks one of the node's
+//     Links (Greedy, the default, takes the highest-weight one).
 //   - If neither exists, execution ends and this Result is returned to the caller.
 type Result struct {
 	// Value is the main output produced by this node.
@@ -19,7 +20,15 @@ type Result struct {
 
 	// Next is the ID of the node to consult after this one.
 	// Setting Next overrides any Links defined in the flow graph.
-	// Leave empty to let the engine follow the highest-weight Link automatically,
-	// or to end the flow if no Links exist.
+	// Leave empty to let the engine's routing Strategy pick one of the node's
+	// Links (see Engine.Routing), or to end the flow if no Links exist.
 	Next string
+
+	// Suspend pauses the run after this node — for example to wait for
+	// human input. The engine still routes as usual; the run stops before
+	// the next node, and Engine.RunTrace returns a Trace that is Suspended,
+	// whose Checkpoint can be passed to Engine.Resume later. Run returns
+	// this Result with Suspend still set.
+	// Suspend is ignored on the last node of a run, and by Engine.Beam.
+	Suspend bool
 }
@@ -0,0 +1,148 @@
+package illygen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// Edge is a weighted outgoing Link as seen by a routing Strategy.
+//
+// Pulls and MeanReward summarise the feedback given for runs that followed
+// this Link (see Flow.Feedback). Bandit strategies route on them.
+type Edge struct {
+	From       string
+	To         string
+	Weight     float64
+	Pulls      int
+	MeanReward float64
+}
+
+// Rand is the source of randomness handed to a Strategy.
+// Values are uniformly distributed in [0.0, 1.0).
+// A *rand.Rand satisfies it.
+type Rand interface {
+	Float64() float64
+}
+
+// Strategy decides which outgoing Link the engine follows when a node
+// leaves Result.Next empty.
+//
+// Choose is only called when there is at least one edge, and edges are
+// sorted by weight descending. It must return one of the given edges.
+// Strategies are shared by every run of an Engine, so Choose must be safe
+// for concurrent use.
+type Strategy interface {
+	Choose(from string, edges []Edge, rnd Rand) Edge
+}
+
+// Greedy returns the default Strategy: always follow the highest-weight Link.
+// Lower-weight links are never explored.
+func Greedy() Strategy {
+	return greedy{}
+}
+
+// Softmax returns a Strategy that samples an outgoing Link with probability
+// proportional to exp(weight / temperature).
+//
+// A high temperature explores almost uniformly; a low temperature behaves
+// almost like Greedy. A temperature of 0 or less is exactly Greedy.
+//
+//	engine := illygen.NewEngine().Routing(illygen.Softmax(0.5)).Seed(42)
+func Softmax(temperature float64) Strategy {
+	if temperature <= 0 {
+		return greedy{}
+	}
+	return softmax{temperature: temperature}
+}
+
+// EpsilonGreedy returns a Strategy that follows the highest-weight Link,
+// except with probability epsilon, when it picks a Link uniformly at random.
+// Epsilon is clamped to the range 0.0 to 1.0.
+func EpsilonGreedy(epsilon float64) Strategy {
+	return epsilonGreedy{epsilon: clamp01(epsilon)}
+}
+
+type greedy struct{}
+
+func (greedy) Choose(_ string, edges []Edge, _ Rand) Edge {
+	return edges[0]
+}
+
+type softmax struct {
+	temperature float64
+}
+
+func (s softmax) Choose(_ string, edges []Edge, rnd Rand) Edge {
+	// Subtract the max weight before exponentiating to keep exp() stable.
+	// edges[0] holds the max because edges are sorted by weight descending.
+	top := edges[0].Weight
+	scores := make([]float64, len(edges))
+	var total float64
+	for i, e := range edges {
+		scores[i] = math.Exp((e.Weight - top) / s.temperature)
+		total += scores[i]
+	}
+	return edges[sample(scores, total, rnd)]
+}
+
+type epsilonGreedy struct {
+	epsilon float64
+}
+
+func (s epsilonGreedy) Choose(_ string, edges []Edge, rnd Rand) Edge {
+	if rnd.Float64() < s.epsilon {
+		return edges[int(rnd.Float64()*float64(len(edges)))%len(edges)]
+	}
+	return edges[0]
+}
+
+// sample picks an index with probability scores[i] / total.
+func sample(scores []float64, total float64, rnd Rand) int {
+	r := rnd.Float64() * total
+	for i, s := range scores {
+		if r < s {
+			return i
+		}
+		r -= s
+	}
+	return len(scores) - 1
+}
+
+// strategyName names s for Step.Strategy.
+func strategyName(s Strategy) string {
+	switch s.(type) {
+	case greedy:
+		return "greedy"
+	case softmax:
+		return "softmax"
+	case epsilonGreedy:
+		return "epsilon-greedy"
+	case ucb1:
+		return "ucb1"
+	case thompson:
+		return "thompson-sampling"
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// lockedRand makes a *rand.Rand safe to share between concurrent runs.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand(seed int64) *lockedRand {
+	return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
@@ -0,0 +1,234 @@
+package illygen
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Field declares a Context key that a node reads or writes, or that the
+// caller of Run supplies, together with its type.
+// Build one from a typed key with Key.Field or Key.Optional.
+type Field struct {
+	// Name is the Context key.
+	Name string
+
+	// Type is the Go type of the value. An interface type (such as any)
+	// accepts every value that implements it.
+	Type reflect.Type
+
+	// Optional marks a flow input that callers may leave out, or a key a
+	// node reads but copes without: Flow.Validate only checks an optional
+	// read's type, not that anything writes it.
+	Optional bool
+}
+
+// Field declares the key as a required Field of type T.
+func (k Key[T]) Field() Field {
+	return Field{Name: k.name, Type: reflect.TypeOf((*T)(nil)).Elem()}
+}
+
+// Optional declares the key as an optional Field of type T.
+func (k Key[T]) Optional() Field {
+	f := k.Field()
+	f.Optional = true
+	return f
+}
+
+// accepts reports whether v is a valid value for the field, allowing the
+// same lossless numeric conversions as Key.Get.
+func (f Field) accepts(v any) bool {
+	if f.Type == nil {
+		return true
+	}
+	if v == nil {
+		return f.Type.Kind() == reflect.Interface
+	}
+	if reflect.TypeOf(v).AssignableTo(f.Type) {
+		return true
+	}
+	_, ok := convertNumber(v, f.Type)
+	return ok
+}
+
+// compatible reports whether a value written as w can be read as r.
+func compatible(w, r Field) bool {
+	switch {
+	case w.Type == nil || r.Type == nil:
+		return true
+	case w.Type.AssignableTo(r.Type):
+		return true
+	case isNumber(w.Type) && isNumber(r.Type):
+		return true // checked leniently at read time, like Key.Get
+	}
+	return false
+}
+
+func isNumber(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// SchemaError describes one broken Context contract, found either by
+// Flow.Validate or when a run's input Context is checked against Flow.Inputs.
+// Several SchemaErrors are combined with errors.Join; use errors.As to
+// inspect the first one.
+type SchemaError struct {
+	// NodeID is the node whose contract is broken, empty for flow inputs.
+	NodeID string
+
+	// Key is the Context key concerned.
+	Key string
+
+	// Problem describes what is wrong.
+	Problem string
+}
+
+func (e *SchemaError) Error() string {
+	if e.NodeID == "" {
+		return fmt.Sprintf("illygen: input %q %s", e.Key, e.Problem)
+	}
+	return fmt.Sprintf("illygen: node %q %s", e.NodeID, e.Problem)
+}
+
+// Reads declares the Context keys the node reads. Flow.Validate checks
+// that each one is written by an upstream node or is a flow input.
+// Returns the Node for chaining.
+//
+//	action := illygen.NewNode("action", fn).Reads(Intent.Field())
+func (n *Node) Reads(fields ...Field) *Node {
+	n.reads = append(n.reads, fields...)
+	return n
+}
+
+// Writes declares the Context keys the node writes.
+// Returns the Node for chaining.
+func (n *Node) Writes(fields ...Field) *Node {
+	n.writes = append(n.writes, fields...)
+	return n
+}
+
+// Inputs declares the Context keys callers supply to Run.
+// Once declared, every run checks its input Context first and fails with a
+// *SchemaError for each required input that is missing or has the wrong
+// type, combined with errors.Join.
+// Returns the Flow for chaining.
+func (f *Flow) Inputs(fields ...Field) *Flow {
+	f.inputs = append(f.inputs, fields...)
+	return f
+}
+
+// Validate statically checks the Context contracts declared with
+// Node.Reads, Node.Writes and Flow.Inputs: every key a node reads must be
+// a flow input or be written by an upstream node, with a compatible type.
+// Optional reads (Key.Optional) need not be written, but when they are,
+// their types are checked too.
+//
+// Upstream nodes are those that can reach the reading node through Links —
+// a node that only routes through Result.Next should Link its targets too.
+// Nodes without declarations are not checked. All problems are reported
+// at once, as *SchemaErrors joined with errors.Join.
+//
+//	if err := flow.Validate(); err != nil {
+//	    log.Fatal(err)
+//	}
+func (f *Flow) Validate() error {
+	inputs := make(map[string]Field, len(f.inputs))
+	for _, in := range f.inputs {
+		inputs[in.Name] = in
+	}
+
+	var errs []error
+	for _, id := range sortedKeys(f.nodes) {
+		node := f.nodes[id]
+		if len(node.reads) == 0 {
+			continue
+		}
+		upstream := f.upstream(id)
+
+		for _, r := range node.reads {
+			if in, ok := inputs[r.Name]; ok {
+				if !compatible(in, r) {
+					errs = append(errs, &SchemaError{NodeID: id, Key: r.Name, Problem: fmt.Sprintf(
+						"reads %q as %s but the flow input is %s", r.Name, r.Type, in.Type,
+					)})
+				}
+				continue
+			}
+
+			writers := 0
+			for _, up := range upstream {
+				for _, w := range f.nodes[up].writes {
+					if w.Name != r.Name {
+						continue
+					}
+					writers++
+					if !compatible(w, r) {
+						errs = append(errs, &SchemaError{NodeID: id, Key: r.Name, Problem: fmt.Sprintf(
+							"reads %q as %s but node %q writes it as %s", r.Name, r.Type, up, w.Type,
+						)})
+					}
+				}
+			}
+			if writers == 0 && !r.Optional {
+				errs = append(errs, &SchemaError{NodeID: id, Key: r.Name, Problem: fmt.Sprintf(
+					"reads %q but no upstream node writes it and it is not a flow input", r.Name,
+				)})
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// upstream returns every node that can reach id through Links, sorted.
+// id itself is included only if it sits on a cycle.
+func (f *Flow) upstream(id string) []string {
+	preds := make(map[string][]string)
+	for _, e := range f.graph.All() {
+		preds[e.To] = append(preds[e.To], e.From)
+	}
+
+	seen := make(map[string]bool)
+	queue := []string{id}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, p := range preds[cur] {
+			if !seen[p] {
+				seen[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	out := make([]string, 0, len(seen))
+	for p := range seen {
+		if _, ok := f.nodes[p]; ok {
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// validateInputs checks a run's input Context against the flow's declared
+// inputs. Returns nil if the flow declares none.
+func (f *Flow) validateInputs(ctx Context) error {
+	var errs []error
+	for _, in := range f.inputs {
+		v, ok := ctx[in.Name]
+		switch {
+		case !ok && !in.Optional:
+			errs = append(errs, &SchemaError{Key: in.Name, Problem: fmt.Sprintf("is required (%s) but missing", in.Type)})
+		case ok && !in.accepts(v):
+			errs = append(errs, &SchemaError{Key: in.Name, Problem: fmt.Sprintf("must be %s, got %T", in.Type, v)})
+		}
+	}
+	return errors.Join(errs...)
+}
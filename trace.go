@@ -0,0 +1,157 @@
+package illygen
+
+import (
+	"slices"
+	"time"
+
+	"github.com/leraniode/illygen/internal/runtime"
+)
+
+// RouteReason records how the engine chose the node that followed a step.
+type RouteReason string
+
+const (
+	// RouteNext means the node set Result.Next explicitly.
+	RouteNext RouteReason = "next"
+
+	// RouteLink means the node left Result.Next empty and the engine's
+	// routing Strategy picked one of the node's outgoing Links.
+	RouteLink RouteReason = "link"
+
+	// RouteEnd means there was no next node — the flow ended here.
+	RouteEnd RouteReason = "end"
+)
+
+// Step records what happened at a single node during a run.
+type Step struct {
+	// NodeID is the node that was consulted.
+	NodeID string
+
+	// Value and Confidence are what the node returned.
+	Value      any
+	Confidence float64
+
+	// Next is the node the engine moved to afterwards. Empty on the last step.
+	Next string
+
+	// Route is how Next was chosen.
+	Route RouteReason
+
+	// Links are the node's outgoing Links as they stood when the step ran,
+	// weights and feedback included, by weight descending.
+	Links []Edge
+
+	// Strategy names the routing Strategy that chose Next, if Route is
+	// RouteLink: "greedy", "softmax", "epsilon-greedy", "ucb1",
+	// "thompson-sampling", or the Go type of any other Strategy.
+	Strategy string
+
+	// Duration is how long the step took, including Middleware and routing.
+	Duration time.Duration
+
+	// Changes lists the Context keys the node added, changed or removed,
+	// sorted by key. Only recorded with Engine.RecordChanges.
+	Changes []Change
+
+	// Knowledge lists the IDs of the KnowledgeUnits the node consulted
+	// through Knowledge(ctx), in the order it first saw them.
+	Knowledge []string
+
+	// Accesses lists every query the node made through Knowledge(ctx),
+	// in order, including those that returned nothing.
+	Accesses []KnowledgeAccess
+}
+
+// Trace is the inspectable record of a single flow execution.
+// Get one from Engine.RunTrace.
+//
+// A Trace is what feedback is given against — see Flow.Feedback.
+type Trace struct {
+	// Flow is the name of the flow that ran (see Flow.Named).
+	Flow string
+
+	// Steps holds every node visited, in order.
+	Steps []Step
+
+	// Result is what Engine.Run would have returned for this run.
+	Result Result
+
+	// Context is the Context as the last node left it, without internal
+	// keys. With Engine.Isolate it is the run's private copy; otherwise it
+	// is the caller's own Context.
+	Context Context
+
+	// Initial is a copy of the input Context, without internal keys.
+	// Only recorded with Engine.RecordChanges; see Trace.ContextAt.
+	Initial Context
+
+	// Suspended reports that a node returned Result.Suspend and the run
+	// stopped before its next node. Save Checkpoint and pass it to
+	// Engine.Resume to continue.
+	Suspended bool
+
+	// Recording is the run's Recording, with Engine.RecordRuns.
+	Recording *Recording
+
+	checkpoint *checkpoint // set when Suspended
+}
+
+// newTrace converts the internal runtime trace into a public Trace.
+func newTrace(rt *runtime.ExecutionTrace) *Trace {
+	t := &Trace{
+		Steps: make([]Step, len(rt.Steps)),
+		Result: Result{
+			Value:      rt.Final.Value,
+			Confidence: rt.Final.Confidence,
+			Suspend:    !rt.Done,
+		},
+	}
+	for i, s := range rt.Steps {
+		t.Steps[i] = publicStep(s)
+	}
+	return t
+}
+
+func publicStep(s runtime.Step) Step {
+	data, _ := s.Data.(stepData)
+	return Step{
+		NodeID:     s.NodeID,
+		Value:      s.Value,
+		Confidence: s.Confidence,
+		Next:       s.Next,
+		Route:      RouteReason(s.Route),
+		Links:      data.links,
+		Strategy:   data.strategy,
+		Duration:   s.Duration,
+		Changes:    data.changes,
+		Knowledge:  data.knowledge,
+		Accesses:   data.accesses,
+	}
+}
+
+// stepData is what the engine's executor carries through runtime.Step.Data.
+type stepData struct {
+	changes   []Change
+	knowledge []string
+	accesses  []KnowledgeAccess
+	links     []Edge
+	strategy  string
+
+	// ctx is the private Context a timed node ran on, merged back into
+	// the run's Context only once the node finished in time.
+	ctx Context
+}
+
+// Knowledge returns the IDs of every KnowledgeUnit consulted during the
+// run, in the order they were first consulted.
+func (t *Trace) Knowledge() []string {
+	var ids []string
+	for _, step := range t.Steps {
+		for _, id := range step.Knowledge {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
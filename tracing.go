@@ -0,0 +1,275 @@
+package illygen
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Tracer creates spans for runs and node executions, so Illygen can be
+// plugged into any distributed-tracing stack without depending on it.
+// Implementations must be safe for concurrent use.
+//
+// NewSpanRecorder provides an in-memory implementation.
+type Tracer interface {
+	// StartSpan starts a span that began at start.
+	// parent is nil for the root span of a run.
+	StartSpan(parent Span, name string, start time.Time) Span
+}
+
+// Span is a single timed operation created by a Tracer.
+type Span interface {
+	// SetAttribute attaches a key/value pair to the span.
+	SetAttribute(key string, value any)
+
+	// End finishes the span at end. A non-nil err marks the span as failed.
+	End(end time.Time, err error)
+}
+
+// Tracer makes the engine create one root span per run ("illygen.run")
+// and one child span per node execution ("illygen.node"), with attributes
+// for the node ID, confidence and routing decision.
+// It is built on Hooks, so it can be combined with other hooks freely.
+// Returns the Engine for chaining.
+//
+//	recorder := illygen.NewSpanRecorder()
+//	engine := illygen.NewEngine().Tracer(recorder)
+func (e *Engine) Tracer(t Tracer) *Engine {
+	if t == nil {
+		return e
+	}
+	var roots sync.Map // run ID → root Span
+	return e.Hooks(Hooks{
+		OnRunStart: func(run *RunInfo) {
+			span := t.StartSpan(nil, "illygen.run", run.Start)
+			span.SetAttribute("illygen.flow", run.Flow.name)
+			span.SetAttribute("illygen.run_id", run.ID)
+			roots.Store(run.ID, span)
+		},
+		OnStep: func(run *RunInfo, step Step) {
+			root, _ := roots.Load(run.ID)
+			end := time.Now()
+			span := t.StartSpan(root.(Span), "illygen.node", end.Add(-step.Duration))
+			span.SetAttribute("illygen.node", step.NodeID)
+			span.SetAttribute("illygen.confidence", step.Confidence)
+			span.SetAttribute("illygen.next", step.Next)
+			span.SetAttribute("illygen.route", string(step.Route))
+			span.End(end, nil)
+		},
+		OnRunEnd: func(run *RunInfo, trace *Trace, err error) {
+			root, _ := roots.LoadAndDelete(run.ID)
+			span := root.(Span)
+			if trace != nil {
+				span.SetAttribute("illygen.steps", len(trace.Steps))
+				span.SetAttribute("illygen.confidence", trace.Result.Confidence)
+			}
+			span.End(time.Now(), err)
+		},
+	})
+}
+
+// RecordedSpan is a finished span captured by a SpanRecorder.
+type RecordedSpan struct {
+	TraceID    string // 32 hex characters
+	SpanID     string // 16 hex characters
+	ParentID   string // empty for root spans
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]any
+	Err        error
+}
+
+// SpanRecorder is a Tracer that keeps every finished span in memory.
+// It can dump them as OpenTelemetry-compatible JSON (OTLP/JSON) with
+// WriteJSON, ready to be sent to a collector or inspected by hand.
+// It is safe for concurrent use.
+type SpanRecorder struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+// NewSpanRecorder creates an empty SpanRecorder.
+func NewSpanRecorder() *SpanRecorder {
+	return &SpanRecorder{}
+}
+
+// StartSpan implements Tracer.
+func (r *SpanRecorder) StartSpan(parent Span, name string, start time.Time) Span {
+	s := &recordingSpan{recorder: r, span: RecordedSpan{
+		SpanID:     randomHex(8),
+		Name:       name,
+		Start:      start,
+		Attributes: make(map[string]any),
+	}}
+	if p, ok := parent.(*recordingSpan); ok {
+		s.span.TraceID = p.span.TraceID
+		s.span.ParentID = p.span.SpanID
+	} else {
+		s.span.TraceID = randomHex(16)
+	}
+	return s
+}
+
+// Spans returns every finished span, in the order they ended.
+func (r *SpanRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedSpan(nil), r.spans...)
+}
+
+// Reset discards every recorded span.
+func (r *SpanRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
+
+// WriteJSON writes every finished span as an OTLP/JSON trace export
+// ({"resourceSpans": [...]}), the format accepted by OpenTelemetry
+// collectors and the otlp file exporters.
+func (r *SpanRecorder) WriteJSON(w io.Writer) error {
+	spans := r.Spans()
+	out := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		out[i] = toOTLP(s)
+	}
+
+	doc := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": []otlpKeyValue{otlpAttribute("service.name", "illygen")},
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "github.com/leraniode/illygen"},
+				"spans": out,
+			}},
+		}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+type recordingSpan struct {
+	recorder *SpanRecorder
+	mu       sync.Mutex
+	span     RecordedSpan
+	ended    bool
+}
+
+func (s *recordingSpan) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.span.Attributes[key] = value
+}
+
+func (s *recordingSpan) End(end time.Time, err error) {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.span.End = end
+	s.span.Err = err
+	span := s.span
+	s.mu.Unlock()
+
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.recorder.spans = append(s.recorder.spans, span)
+}
+
+// OTLP/JSON encoding — see opentelemetry-proto's trace.proto.
+// IDs are hex strings and 64-bit integers are decimal strings.
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpKindInternal = 1
+	otlpStatusOK     = 1
+	otlpStatusError  = 2
+)
+
+func toOTLP(s RecordedSpan) otlpSpan {
+	keys := make([]string, 0, len(s.Attributes))
+	for k := range s.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]otlpKeyValue, len(keys))
+	for i, k := range keys {
+		attrs[i] = otlpAttribute(k, s.Attributes[k])
+	}
+
+	status := otlpStatus{Code: otlpStatusOK}
+	if s.Err != nil {
+		status = otlpStatus{Code: otlpStatusError, Message: s.Err.Error()}
+	}
+
+	return otlpSpan{
+		TraceID:           s.TraceID,
+		SpanID:            s.SpanID,
+		ParentSpanID:      s.ParentID,
+		Name:              s.Name,
+		Kind:              otlpKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Attributes:        attrs,
+		Status:            status,
+	}
+}
+
+func otlpAttribute(key string, value any) otlpKeyValue {
+	var v map[string]any
+	switch x := value.(type) {
+	case string:
+		v = map[string]any{"stringValue": x}
+	case bool:
+		v = map[string]any{"boolValue": x}
+	case int:
+		v = map[string]any{"intValue": strconv.FormatInt(int64(x), 10)}
+	case int64:
+		v = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+	case uint64:
+		v = map[string]any{"intValue": strconv.FormatUint(x, 10)}
+	case float64:
+		v = map[string]any{"doubleValue": x}
+	default:
+		v = map[string]any{"stringValue": fmt.Sprint(x)}
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
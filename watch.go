@@ -0,0 +1,151 @@
+package illygen
+
+import (
+	"sync"
+	"time"
+)
+
+// KnowledgeEvent is a change to a KnowledgeUnit, delivered to every
+// KnowledgeWatch on its domain.
+type KnowledgeEvent struct {
+	// Kind is the change made.
+	Kind VersionKind
+
+	ID     string
+	Domain string
+
+	// Before and After are the unit before and after the change. Before
+	// is nil for an added unit, After for a deleted one.
+	Before, After *KnowledgeUnit
+
+	// Version, Time and Author are those of the KnowledgeVersion the change
+	// recorded.
+	Version int
+	Time    time.Time
+	Author  string
+
+	// Missed counts the events dropped since the previous event delivered,
+	// because the watch's buffer was full. If it is not 0, whatever the
+	// events are feeding is out of date and should be rebuilt from the store.
+	Missed int
+}
+
+// WatchOptions tunes a KnowledgeWatch. The zero value uses the defaults.
+type WatchOptions struct {
+	// Buffer is how many undelivered events the watch holds before it
+	// starts dropping them. Default 64.
+	Buffer int
+}
+
+// KnowledgeWatch streams the changes made to a KnowledgeStore.
+// Get one from KnowledgeStore.Watch.
+type KnowledgeWatch struct {
+	base   *knowledgeBase
+	domain string
+	events chan KnowledgeEvent
+	missed int // guarded by base.mu
+	once   sync.Once
+}
+
+// Watch subscribes to the changes made to units of domain — to every
+// domain if domain is empty. Events arrive on the watch's Events channel
+// in the order the changes were made, decayed weights written back by
+// Sweep excepted.
+//
+// Writers never wait for watchers: when the watch's buffer is full, new
+// events are dropped, and the next event delivered says how many were
+// missed. If no event follows, Missed says so instead. Call Stop to
+// unsubscribe.
+//
+//	w := store.Watch("greetings")
+//	defer w.Stop()
+//	for e := range w.Events() {
+//	    if e.Missed > 0 {
+//	        rebuild(store.Domain("greetings"))
+//	        continue
+//	    }
+//	    index.Apply(e.Before, e.After)
+//	}
+func (s *KnowledgeStore) Watch(domain string, opts ...WatchOptions) *KnowledgeWatch {
+	var o WatchOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Buffer <= 0 {
+		o.Buffer = 64
+	}
+	w := &KnowledgeWatch{base: s.base, domain: domain, events: make(chan KnowledgeEvent, o.Buffer)}
+
+	s.base.mu.Lock()
+	defer s.base.mu.Unlock()
+	s.base.watches[w] = true
+	return w
+}
+
+// Events returns the channel events are delivered on. It is closed by Stop.
+func (w *KnowledgeWatch) Events() <-chan KnowledgeEvent {
+	return w.events
+}
+
+// Missed returns how many events were dropped because the buffer was full
+// and not yet reported, by a delivered event's Missed or an earlier call,
+// and resets the count. Check it once Events is drained — the store may
+// have gone quiet right after an overflow — and after Stop.
+func (w *KnowledgeWatch) Missed() int {
+	w.base.mu.Lock()
+	defer w.base.mu.Unlock()
+	n := w.missed
+	w.missed = 0
+	return n
+}
+
+// Stop unsubscribes the watch and closes its Events channel. Events still
+// buffered can be read until it is drained, and Missed still reports the
+// events dropped. Stop may be called more than once.
+func (w *KnowledgeWatch) Stop() {
+	w.once.Do(func() {
+		w.base.mu.Lock()
+		defer w.base.mu.Unlock()
+		delete(w.base.watches, w)
+		close(w.events)
+	})
+}
+
+// changed notifies watchers of a change from before to after, either of
+// which may be nil. The caller must hold b.mu for writing.
+func (b *knowledgeBase) changed(before, after *KnowledgeUnit, v KnowledgeVersion) {
+	u := after
+	if u == nil {
+		u = before
+	}
+	if u == nil || len(b.watches) == 0 {
+		return
+	}
+	b.notify(KnowledgeEvent{
+		Kind:    v.Kind,
+		ID:      u.ID,
+		Domain:  u.Domain,
+		Before:  before,
+		After:   after,
+		Version: v.Version,
+		Time:    v.Time,
+		Author:  v.Author,
+	})
+}
+
+// notify delivers e to every watch on its domain, without blocking.
+// The caller must hold b.mu for writing.
+func (b *knowledgeBase) notify(e KnowledgeEvent) {
+	for w := range b.watches {
+		if w.domain != "" && w.domain != e.Domain && !(e.Before != nil && w.domain == e.Before.Domain) {
+			continue
+		}
+		e.Missed = w.missed
+		select {
+		case w.events <- e:
+			w.missed = 0
+		default:
+			w.missed++
+		}
+	}
+}
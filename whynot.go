@@ -0,0 +1,267 @@
+package illygen
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// WhyNot answers "why didn't the run reach Target?" for a finished run.
+// Get one from Engine.WhyNot or Engine.WhyNotValue.
+type WhyNot struct {
+	// Target is the node the run did not reach.
+	Target string
+
+	// Reached is true if the run did visit Target after all.
+	Reached bool
+
+	// Steps lists, for every step of the run, the Link it followed and
+	// the other Links it could have followed.
+	Steps []Alternatives
+
+	// Weights is the smallest change to Link weights that would have led
+	// the run to Target, nil if no weight change can.
+	Weights *WeightChange
+
+	// Decisions lists the steps whose node chose Next itself, with the
+	// inputs it decided on. Weights do not affect those choices; only a
+	// different Context could have.
+	Decisions []DecisionInputs
+}
+
+// Alternatives describes the routing choice made at one step.
+type Alternatives struct {
+	Step   int
+	NodeID string
+	Route  RouteReason
+
+	// Chosen is the Link followed. Only From and To are set if the node
+	// routed with Result.Next to a node it has no Link to.
+	Chosen Edge
+
+	// Others are the node's other outgoing Links, by weight descending.
+	Others []Alternative
+}
+
+// Alternative is a Link a step could have followed instead.
+type Alternative struct {
+	Edge
+
+	// Reaches is true if Target is this Link's node or can be reached
+	// from it through Links.
+	Reaches bool
+}
+
+// WeightChange is a set of Link weight increases that would have made
+// Greedy routing lead the run to Target, diverging from the actual path
+// at Step. Changes assume the nodes after the divergence leave
+// Result.Next empty and follow their Links.
+type WeightChange struct {
+	Step  int
+	Links []LinkChange
+
+	// Total is the sum of every LinkChange's Delta.
+	Total float64
+}
+
+// LinkChange is one Link whose weight must rise above Exceed — the weight
+// of the strongest competing Link from the same node. Delta is
+// Exceed - Weight, 0 if the Link only loses a tie.
+type LinkChange struct {
+	From, To string
+	Weight   float64
+	Exceed   float64
+	Delta    float64
+}
+
+// DecisionInputs is a step whose node chose Next explicitly, and what it
+// decided on: Keys are the Context keys the node declares it reads (see
+// Node.Reads) and Values their values when the node ran, if the run
+// recorded them (Engine.RecordChanges). It reports the inputs to the
+// decision, not which of them would have to change, or how, to reach
+// Target: nodes are opaque functions, so that is left to the caller.
+type DecisionInputs struct {
+	Step   int
+	NodeID string
+	Next   string
+	Keys   []string
+	Values Context
+}
+
+// WhyNot compares a run of flow with the routes that could have led it to
+// the target node. It reports the alternatives at every step, the smallest
+// Link weight change that would have reached target, and the inputs of the
+// steps where only a different Context could have changed the path.
+// It is computed from the flow's graph; no node is run.
+// Returns an error if trace is nil or target is not in the flow.
+//
+//	answer, _ := engine.WhyNot(flow, trace, "farewell")
+//	if w := answer.Weights; w != nil {
+//	    for _, l := range w.Links {
+//	        fmt.Printf("raise %s → %s above %.2f\n", l.From, l.To, l.Exceed)
+//	    }
+//	}
+func (e *Engine) WhyNot(flow *Flow, trace *Trace, target string) (*WhyNot, error) {
+	if trace == nil {
+		return nil, fmt.Errorf("illygen: WhyNot called with nil trace")
+	}
+	if _, err := flow.node(target); err != nil {
+		return nil, err
+	}
+	w := &WhyNot{Target: target}
+
+	for i, step := range trace.Steps {
+		if step.NodeID == target {
+			w.Reached = true
+		}
+		alt := Alternatives{Step: i, NodeID: step.NodeID, Route: step.Route, Chosen: Edge{From: step.NodeID, To: step.Next}}
+		for _, edge := range flow.Edges(step.NodeID) {
+			if edge.To == step.Next {
+				alt.Chosen = edge
+				continue
+			}
+			alt.Others = append(alt.Others, Alternative{Edge: edge, Reaches: flow.reaches(edge.To, target)})
+		}
+		w.Steps = append(w.Steps, alt)
+
+		if step.Route == RouteNext {
+			w.Decisions = append(w.Decisions, flow.decisionInputs(trace, i))
+		}
+	}
+	if w.Reached {
+		return w, nil
+	}
+
+	for i, step := range trace.Steps {
+		if step.Route == RouteNext {
+			continue // the node ignored weights
+		}
+		if c := flow.cheapestRoute(step.NodeID, target); c != nil && (w.Weights == nil || c.Total <= w.Weights.Total) {
+			c.Step = i
+			w.Weights = c
+		}
+	}
+	return w, nil
+}
+
+// WhyNotValue is WhyNot for a Result value instead of a node. input must
+// be the Context the run started with, such as Trace.Initial. Returns an
+// error if no path produces value.
+//
+// Unlike WhyNot, WhyNotValue runs nodes: it finds the node that would have
+// returned value by an Engine.Beam search from input, which runs every node
+// on every path it explores, then explains why the run did not reach it.
+// Those runs have the nodes' side effects — memory writes, knowledge
+// queries, calls to external services — and Middleware and the Engine's
+// Limits apply to them.
+// Use WhyNot with a target node for nodes that must not be run again.
+func (e *Engine) WhyNotValue(flow *Flow, trace *Trace, input Context, value any) (*WhyNot, error) {
+	if trace == nil {
+		return nil, fmt.Errorf("illygen: WhyNot called with nil trace")
+	}
+	res, err := e.Beam(flow, input, BeamOptions{Width: len(flow.nodes)})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range append([]Candidate{res.Best}, res.Alternatives...) {
+		if reflect.DeepEqual(c.Trace.Result.Value, value) {
+			return e.WhyNot(flow, trace, c.Trace.Steps[len(c.Trace.Steps)-1].NodeID)
+		}
+	}
+	return nil, fmt.Errorf("illygen: no path of the flow returns %v", value)
+}
+
+// reaches reports whether to can be reached from from through Links.
+func (f *Flow) reaches(from, to string) bool {
+	seen := map[string]bool{from: true}
+	queue := []string{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur == to {
+			return true
+		}
+		for _, e := range f.graph.From(cur) {
+			if !seen[e.To] {
+				seen[e.To] = true
+				queue = append(queue, e.To)
+			}
+		}
+	}
+	return false
+}
+
+// cheapestRoute finds the Link path from from to target needing the
+// smallest total weight increase for Greedy routing to follow it
+// (Dijkstra over the flow's Links). Returns nil if target is unreachable.
+func (f *Flow) cheapestRoute(from, target string) *WeightChange {
+	type hop struct {
+		change LinkChange
+		free   bool // already the Link Greedy follows
+	}
+	dist := map[string]float64{from: 0}
+	via := map[string]hop{}
+	done := map[string]bool{}
+
+	for {
+		cur, best := "", math.Inf(1)
+		for id, d := range dist {
+			if !done[id] && (d < best || d == best && id < cur) {
+				cur, best = id, d
+			}
+		}
+		if cur == "" {
+			return nil
+		}
+		if cur == target {
+			break
+		}
+		done[cur] = true
+
+		edges := f.Edges(cur)
+		for i, e := range edges {
+			change := LinkChange{From: e.From, To: e.To, Weight: e.Weight, Exceed: e.Weight}
+			if i > 0 {
+				change.Exceed = edges[0].Weight
+				change.Delta = edges[0].Weight - e.Weight
+			}
+			if d, ok := dist[e.To]; !done[e.To] && (!ok || best+change.Delta < d) {
+				dist[e.To] = best + change.Delta
+				via[e.To] = hop{change: change, free: i == 0}
+			}
+		}
+	}
+
+	c := &WeightChange{Total: dist[target]}
+	for at := target; at != from; at = via[at].change.From {
+		if h := via[at]; !h.free {
+			c.Links = append([]LinkChange{h.change}, c.Links...)
+		}
+	}
+	return c
+}
+
+// decisionInputs describes the explicit routing decision at step i.
+func (f *Flow) decisionInputs(trace *Trace, i int) DecisionInputs {
+	step := trace.Steps[i]
+	c := DecisionInputs{Step: i, NodeID: step.NodeID, Next: step.Next}
+	node, err := f.node(step.NodeID)
+	if err != nil {
+		return c
+	}
+
+	before := trace.Initial
+	if i > 0 {
+		before = trace.ContextAt(i - 1)
+	}
+	for _, r := range node.reads {
+		c.Keys = append(c.Keys, r.Name)
+		if v, ok := before[r.Name]; ok {
+			if c.Values == nil {
+				c.Values = Context{}
+			}
+			c.Values[r.Name] = v
+		}
+	}
+	return c
+}